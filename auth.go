@@ -0,0 +1,85 @@
+package eupho
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// tokenKey is the gRPC metadata key the slaves send the token with.
+const tokenKey = "eupho-token"
+
+// loadToken returns the shared secret given by --token, --token-file or
+// EUPHO_TOKEN, in this order, or "" when none is given.
+func loadToken(token, file string) (string, error) {
+	if token != "" {
+		return token, nil
+	}
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		token = strings.TrimSpace(string(b))
+		if token == "" {
+			return "", fmt.Errorf("%s is empty", file)
+		}
+		return token, nil
+	}
+	return os.Getenv("EUPHO_TOKEN"), nil
+}
+
+// tokenCredentials attaches the token to every RPC of a slave.
+type tokenCredentials string
+
+func (c tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{tokenKey: string(c)}, nil
+}
+
+// The token only keeps out slaves of other runs, so it is sent over plain
+// connections as well.
+func (c tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// authenticator rejects the RPCs of slaves without the token of the master.
+type authenticator struct {
+	token string
+}
+
+func (a *authenticator) check(ctx context.Context, method string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	tokens := md.Get(tokenKey)
+	reason := "no token"
+	if len(tokens) > 0 {
+		if subtle.ConstantTimeCompare([]byte(tokens[0]), []byte(a.token)) == 1 {
+			return nil
+		}
+		reason = "wrong token"
+	}
+	log.Printf("reject: %s from %s (%s)", method, peerAddr(ctx), reason)
+	return status.Errorf(codes.Unauthenticated, "%s: the master needs the token of this run", reason)
+}
+
+func (a *authenticator) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := a.check(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *authenticator) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := a.check(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,118 @@
+package eupho
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestLoadToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eupho")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "token")
+	ioutil.WriteFile(file, []byte("from-file\n"), 0600)
+	empty := filepath.Join(dir, "empty")
+	ioutil.WriteFile(empty, []byte("\n"), 0600)
+
+	os.Setenv("EUPHO_TOKEN", "from-env")
+	defer os.Unsetenv("EUPHO_TOKEN")
+
+	for _, tc := range []struct {
+		token, file, want string
+		wantErr           bool
+	}{
+		{token: "from-flag", file: file, want: "from-flag"},
+		{file: file, want: "from-file"},
+		{want: "from-env"},
+		{file: empty, wantErr: true},
+		{file: filepath.Join(dir, "missing"), wantErr: true},
+	} {
+		got, err := loadToken(tc.token, tc.file)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("loadToken(%q, %q): unexpected error %v", tc.token, tc.file, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("loadToken(%q, %q)\nwant %q\ngot  %q", tc.token, tc.file, tc.want, got)
+		}
+	}
+}
+
+func TestToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eupho")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "01.t"), []byte(`print "1..1\nok 1\n";`), 0644)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	mc := DefaultMasterConfig()
+	mc.Addr = addr
+	mc.Quiet = true
+	mc.Formatter = []string{"json:" + filepath.Join(dir, "report.json")}
+	mc.Token = "secret"
+	m, err := NewMasterWithConfig(mc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type outcome struct {
+		res *RunResult
+		err error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		res, err := m.RunContext(context.Background())
+		done <- outcome{res, err}
+	}()
+
+	sc := DefaultSlaveConfig()
+	sc.Addr = addr
+	sc.Quiet = true
+	sc.MaxRetry = 2
+	sc.MaxDelay = 100 * time.Millisecond
+	sc.Args = []string{filepath.Join(dir, "01.t")}
+	for _, token := range []string{"", "stale"} {
+		sc.Token = token
+		s, err := NewSlaveWithConfig(sc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.RunContext(context.Background()); err == nil {
+			t.Errorf("want an error for a slave with token %q", token)
+		}
+	}
+
+	sc.Token = "secret"
+	s, err := NewSlaveWithConfig(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RunContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	o := <-done
+	if o.err != nil {
+		t.Fatal(o.err)
+	}
+	if o.res.Files != 1 || !o.res.Ok() {
+		t.Errorf("want 1 passed test file\ngot %+v", o.res)
+	}
+}
@@ -8,7 +8,5 @@ import (
 )
 
 func main() {
-	s := eupho.NewSlave()
-	s.ParseArgs(os.Args[1:])
-	s.Run(nil)
+	os.Exit(eupho.NewSlave().Run(os.Args[1:]))
 }
@@ -8,7 +8,5 @@ import (
 )
 
 func main() {
-	s := eupho.NewSolo()
-	s.ParseArgs(os.Args[1:])
-	os.Exit(s.Run(nil))
+	os.Exit(eupho.NewSolo().Run(os.Args[1:]))
 }
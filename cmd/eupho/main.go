@@ -7,7 +7,9 @@ import (
 )
 
 func main() {
-	m := eupho.NewMaster()
-	m.ParseArgs(os.Args[1:])
-	os.Exit(m.Run(nil))
+	if len(os.Args) > 1 && os.Args[1] == "merge" {
+		os.Exit(eupho.NewMerge().Run(os.Args[2:]))
+	}
+
+	os.Exit(eupho.NewMaster().Run(os.Args[1:]))
 }
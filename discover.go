@@ -0,0 +1,187 @@
+package eupho
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ignoreFile lists the patterns of files and directories to leave out of the
+// discovery, one per line, in the working directory.
+const ignoreFile = ".euphoignore"
+
+// discovery finds the test files in the arguments of the master and the
+// slaves.
+type discovery struct {
+	// Exts are the suffixes of the test files found in directories.
+	Exts []string
+
+	// Include and Exclude are glob patterns. A pattern containing a
+	// separator is matched against the whole path, otherwise against the
+	// base name of each file and directory.
+	Include []string
+	Exclude []string
+
+	// NoRecurse finds the test files directly in the given directories only.
+	NoRecurse bool
+}
+
+// find returns the sorted test files in files, directories or globs, "t" by
+// default. Files given explicitly or matched by a glob are taken as they are,
+// the options apply to the files found in directories. Symbolic links to
+// directories are followed once.
+func (d *discovery) find(args []string) ([]string, error) {
+	if len(args) == 0 {
+		args = []string{"t"}
+	}
+
+	exclude, err := readIgnoreFile(ignoreFile)
+	if err != nil {
+		return nil, err
+	}
+	exclude = append(exclude, d.Exclude...)
+
+	w := &walker{discovery: d, exclude: exclude, visited: map[string]bool{}, files: map[string]bool{}}
+	for _, arg := range args {
+		parents := []string{arg}
+		if strings.ContainsAny(arg, "*?[") {
+			parents, err = filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid glob %s: %v", arg, err)
+			}
+			if len(parents) == 0 {
+				return nil, fmt.Errorf("no test files match %s", arg)
+			}
+		}
+		for _, parent := range parents {
+			stat, err := os.Stat(parent)
+			if err != nil {
+				return nil, fmt.Errorf("cannot find test files: %v", err)
+			}
+			if !stat.IsDir() {
+				w.files[parent] = true
+				continue
+			}
+			if err := w.walk(parent); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	files := make([]string, 0, len(w.files))
+	for f := range w.files {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+type walker struct {
+	*discovery
+	exclude []string
+	visited map[string]bool // resolved paths of the walked directories
+	files   map[string]bool
+}
+
+func (w *walker) walk(dir string) error {
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if w.visited[resolved] {
+		return nil
+	}
+	w.visited[resolved] = true
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if matchAny(w.exclude, path) {
+			continue
+		}
+		if entry.Mode()&os.ModeSymlink != 0 {
+			if entry, err = os.Stat(path); err != nil {
+				continue // dangling link
+			}
+		}
+		if entry.IsDir() {
+			if w.NoRecurse {
+				continue
+			}
+			if err := w.walk(path); err != nil {
+				return err
+			}
+			continue
+		}
+		if !w.hasExt(path) {
+			continue
+		}
+		if len(w.Include) > 0 && !matchAny(w.Include, path) {
+			continue
+		}
+		w.files[path] = true
+	}
+	return nil
+}
+
+func (d *discovery) hasExt(path string) bool {
+	exts := d.Exts
+	if len(exts) == 0 {
+		exts = []string{".t"}
+	}
+	for _, ext := range exts {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, path string) bool {
+	path = filepath.ToSlash(filepath.Clean(path))
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+		name := path
+		if !strings.Contains(pattern, "/") {
+			name = path[strings.LastIndex(path, "/")+1:]
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// readIgnoreFile returns the patterns in file, skipping blank lines and
+// comments. A missing file has no patterns.
+func readIgnoreFile(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	patterns := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
@@ -0,0 +1,91 @@
+package eupho
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiscovery_find(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eupho")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{
+		"t/b.t",
+		"t/a.t",
+		"t/lib/helper.pl",
+		"t/sub/c.t",
+		"t/sub/d.py",
+		"t/slow/e.t",
+		"t/fixtures/f.t",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte("print qq{1..0\\n};\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a loop is walked once
+	if err := os.Symlink("..", filepath.Join(dir, "t", "sub", "loop")); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, ignoreFile), []byte("# data, not tests\nfixtures\n"), 0644)
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+
+	cases := []struct {
+		d    discovery
+		args []string
+		want []string
+	}{
+		{
+			d:    discovery{},
+			want: []string{"t/a.t", "t/b.t", "t/slow/e.t", "t/sub/c.t"},
+		},
+		{
+			d:    discovery{Exts: []string{"t", ".py"}, Exclude: []string{"t/slow"}},
+			want: []string{"t/a.t", "t/b.t", "t/sub/c.t", "t/sub/d.py"},
+		},
+		{
+			d:    discovery{Include: []string{"[ac].t"}},
+			want: []string{"t/a.t", "t/sub/c.t"},
+		},
+		{
+			d:    discovery{NoRecurse: true},
+			want: []string{"t/a.t", "t/b.t"},
+		},
+		{
+			d:    discovery{NoRecurse: true},
+			args: []string{"t/sub/d.py", "t/s*"},
+			want: []string{"t/slow/e.t", "t/sub/c.t", "t/sub/d.py"},
+		},
+	}
+	for _, c := range cases {
+		files, err := c.d.find(c.args)
+		if err != nil {
+			t.Errorf("%+v: %v", c.d, err)
+			continue
+		}
+		for i, f := range files {
+			files[i] = filepath.ToSlash(f)
+		}
+		if !reflect.DeepEqual(files, c.want) {
+			t.Errorf("%+v %v:\nwant %v\ngot  %v", c.d, c.args, c.want, files)
+		}
+	}
+
+	d := &discovery{}
+	if _, err := d.find([]string{"t/missing.t"}); err == nil {
+		t.Error("want an error for a missing test file")
+	}
+	if _, err := d.find([]string{"x/*.t"}); err == nil {
+		t.Error("want an error for a glob matching nothing")
+	}
+}
@@ -0,0 +1,57 @@
+package eupho
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// ErrAborted is returned by RunContext when the run was aborted by Abort, a
+// signal, the context or the master, along with the results of the tests
+// finished so far.
+var ErrAborted = errors.New("run aborted")
+
+// ErrTimeout is returned by Master.RunContext when no slave requested a test
+// file or sent a result within the timeout, along with the results so far.
+var ErrTimeout = errors.New("slave request was lost")
+
+// ConfigError reports an invalid value of an option.
+type ConfigError struct {
+	Option string
+	Err    error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid --%s: %v", e.Option, e.Err)
+}
+
+// defaultDuration sets a duration left zero in a config built by hand to the
+// default of its option, and rejects a negative one.
+func defaultDuration(option string, d *time.Duration, def time.Duration) error {
+	switch {
+	case *d < 0:
+		return &ConfigError{Option: option, Err: fmt.Errorf("must not be negative: %s", *d)}
+	case *d == 0:
+		*d = def
+	}
+	return nil
+}
+
+// IsHelp reports whether err is the help message returned by ParseArgs for
+// --help.
+func IsHelp(err error) bool {
+	e, ok := err.(*flags.Error)
+	return ok && e.Type == flags.ErrHelp
+}
+
+// parseFailed prints an error of ParseArgs like the commands always did and
+// returns their exit code.
+func parseFailed(err error) int {
+	fmt.Println(err)
+	if IsHelp(err) {
+		return 0
+	}
+	return 1
+}
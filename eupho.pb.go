@@ -12,6 +12,11 @@ It has these top-level messages:
 	GetTestResponse
 	ResultRequest
 	ResultResponse
+	RegisterRequest
+	RegisterResponse
+	HeartbeatRequest
+	HeartbeatResponse
+	ResultEvent
 */
 package eupho
 
@@ -19,6 +24,7 @@ import proto "github.com/golang/protobuf/proto"
 import fmt "fmt"
 import math "math"
 import pet "gopkg.in/mix3/pet.v3"
+import google_protobuf "github.com/golang/protobuf/ptypes/duration"
 
 import (
 	context "golang.org/x/net/context"
@@ -37,8 +43,11 @@ var _ = math.Inf
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
 type GetTestRequest struct {
-	Submitted bool     `protobuf:"varint,1,opt,name=submitted" json:"submitted,omitempty"`
-	TestFiles []string `protobuf:"bytes,2,rep,name=test_files,json=testFiles" json:"test_files,omitempty"`
+	Submitted      bool     `protobuf:"varint,1,opt,name=submitted" json:"submitted,omitempty"`
+	TestFiles      []string `protobuf:"bytes,2,rep,name=test_files,json=testFiles" json:"test_files,omitempty"`
+	SlaveId        string   `protobuf:"bytes,3,opt,name=slave_id,json=slaveId" json:"slave_id,omitempty"`
+	TestFileMtimes []int64  `protobuf:"varint,4,rep,packed,name=test_file_mtimes,json=testFileMtimes" json:"test_file_mtimes,omitempty"`
+	RunId          string   `protobuf:"bytes,5,opt,name=run_id,json=runId" json:"run_id,omitempty"`
 }
 
 func (m *GetTestRequest) Reset()                    { *m = GetTestRequest{} }
@@ -60,8 +69,30 @@ func (m *GetTestRequest) GetTestFiles() []string {
 	return nil
 }
 
+func (m *GetTestRequest) GetSlaveId() string {
+	if m != nil {
+		return m.SlaveId
+	}
+	return ""
+}
+
+func (m *GetTestRequest) GetTestFileMtimes() []int64 {
+	if m != nil {
+		return m.TestFileMtimes
+	}
+	return nil
+}
+
+func (m *GetTestRequest) GetRunId() string {
+	if m != nil {
+		return m.RunId
+	}
+	return ""
+}
+
 type GetTestResponse struct {
-	Path string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	Path    string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	LeaseId int64  `protobuf:"varint,2,opt,name=lease_id,json=leaseId" json:"lease_id,omitempty"`
 }
 
 func (m *GetTestResponse) Reset()                    { *m = GetTestResponse{} }
@@ -76,9 +107,23 @@ func (m *GetTestResponse) GetPath() string {
 	return ""
 }
 
+func (m *GetTestResponse) GetLeaseId() int64 {
+	if m != nil {
+		return m.LeaseId
+	}
+	return 0
+}
+
 type ResultRequest struct {
-	Path      string         `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
-	Testsuite *pet.Testsuite `protobuf:"bytes,2,opt,name=testsuite" json:"testsuite,omitempty"`
+	Path       string                    `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	Testsuite  *pet.Testsuite            `protobuf:"bytes,2,opt,name=testsuite" json:"testsuite,omitempty"`
+	SlaveId    string                    `protobuf:"bytes,3,opt,name=slave_id,json=slaveId" json:"slave_id,omitempty"`
+	UserTime   *google_protobuf.Duration `protobuf:"bytes,4,opt,name=user_time,json=userTime" json:"user_time,omitempty"`
+	SystemTime *google_protobuf.Duration `protobuf:"bytes,5,opt,name=system_time,json=systemTime" json:"system_time,omitempty"`
+	Stdout     []byte                    `protobuf:"bytes,6,opt,name=stdout,proto3" json:"stdout,omitempty"`
+	Stderr     []byte                    `protobuf:"bytes,7,opt,name=stderr,proto3" json:"stderr,omitempty"`
+	RunId      string                    `protobuf:"bytes,8,opt,name=run_id,json=runId" json:"run_id,omitempty"`
+	LeaseId    int64                     `protobuf:"varint,9,opt,name=lease_id,json=leaseId" json:"lease_id,omitempty"`
 }
 
 func (m *ResultRequest) Reset()                    { *m = ResultRequest{} }
@@ -100,6 +145,55 @@ func (m *ResultRequest) GetTestsuite() *pet.Testsuite {
 	return nil
 }
 
+func (m *ResultRequest) GetSlaveId() string {
+	if m != nil {
+		return m.SlaveId
+	}
+	return ""
+}
+
+func (m *ResultRequest) GetUserTime() *google_protobuf.Duration {
+	if m != nil {
+		return m.UserTime
+	}
+	return nil
+}
+
+func (m *ResultRequest) GetSystemTime() *google_protobuf.Duration {
+	if m != nil {
+		return m.SystemTime
+	}
+	return nil
+}
+
+func (m *ResultRequest) GetStdout() []byte {
+	if m != nil {
+		return m.Stdout
+	}
+	return nil
+}
+
+func (m *ResultRequest) GetStderr() []byte {
+	if m != nil {
+		return m.Stderr
+	}
+	return nil
+}
+
+func (m *ResultRequest) GetRunId() string {
+	if m != nil {
+		return m.RunId
+	}
+	return ""
+}
+
+func (m *ResultRequest) GetLeaseId() int64 {
+	if m != nil {
+		return m.LeaseId
+	}
+	return 0
+}
+
 type ResultResponse struct {
 }
 
@@ -108,11 +202,248 @@ func (m *ResultResponse) String() string            { return proto.CompactTextSt
 func (*ResultResponse) ProtoMessage()               {}
 func (*ResultResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
 
+type RegisterRequest struct {
+	Hostname      string   `protobuf:"bytes,1,opt,name=hostname" json:"hostname,omitempty"`
+	Jobs          int32    `protobuf:"varint,2,opt,name=jobs" json:"jobs,omitempty"`
+	Plugins       []string `protobuf:"bytes,3,rep,name=plugins" json:"plugins,omitempty"`
+	Version       string   `protobuf:"bytes,4,opt,name=version" json:"version,omitempty"`
+	TestFilesHash string   `protobuf:"bytes,5,opt,name=test_files_hash,json=testFilesHash" json:"test_files_hash,omitempty"`
+	Revision      string   `protobuf:"bytes,6,opt,name=revision" json:"revision,omitempty"`
+	RunId         string   `protobuf:"bytes,7,opt,name=run_id,json=runId" json:"run_id,omitempty"`
+}
+
+func (m *RegisterRequest) Reset()                    { *m = RegisterRequest{} }
+func (m *RegisterRequest) String() string            { return proto.CompactTextString(m) }
+func (*RegisterRequest) ProtoMessage()               {}
+func (*RegisterRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *RegisterRequest) GetHostname() string {
+	if m != nil {
+		return m.Hostname
+	}
+	return ""
+}
+
+func (m *RegisterRequest) GetJobs() int32 {
+	if m != nil {
+		return m.Jobs
+	}
+	return 0
+}
+
+func (m *RegisterRequest) GetPlugins() []string {
+	if m != nil {
+		return m.Plugins
+	}
+	return nil
+}
+
+func (m *RegisterRequest) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *RegisterRequest) GetTestFilesHash() string {
+	if m != nil {
+		return m.TestFilesHash
+	}
+	return ""
+}
+
+func (m *RegisterRequest) GetRevision() string {
+	if m != nil {
+		return m.Revision
+	}
+	return ""
+}
+
+func (m *RegisterRequest) GetRunId() string {
+	if m != nil {
+		return m.RunId
+	}
+	return ""
+}
+
+type RegisterResponse struct {
+	SlaveId string `protobuf:"bytes,1,opt,name=slave_id,json=slaveId" json:"slave_id,omitempty"`
+	RunId   string `protobuf:"bytes,2,opt,name=run_id,json=runId" json:"run_id,omitempty"`
+}
+
+func (m *RegisterResponse) Reset()                    { *m = RegisterResponse{} }
+func (m *RegisterResponse) String() string            { return proto.CompactTextString(m) }
+func (*RegisterResponse) ProtoMessage()               {}
+func (*RegisterResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *RegisterResponse) GetSlaveId() string {
+	if m != nil {
+		return m.SlaveId
+	}
+	return ""
+}
+
+func (m *RegisterResponse) GetRunId() string {
+	if m != nil {
+		return m.RunId
+	}
+	return ""
+}
+
+type HeartbeatRequest struct {
+	SlaveId string   `protobuf:"bytes,1,opt,name=slave_id,json=slaveId" json:"slave_id,omitempty"`
+	Running []string `protobuf:"bytes,2,rep,name=running" json:"running,omitempty"`
+	RunId   string   `protobuf:"bytes,3,opt,name=run_id,json=runId" json:"run_id,omitempty"`
+}
+
+func (m *HeartbeatRequest) Reset()                    { *m = HeartbeatRequest{} }
+func (m *HeartbeatRequest) String() string            { return proto.CompactTextString(m) }
+func (*HeartbeatRequest) ProtoMessage()               {}
+func (*HeartbeatRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *HeartbeatRequest) GetSlaveId() string {
+	if m != nil {
+		return m.SlaveId
+	}
+	return ""
+}
+
+func (m *HeartbeatRequest) GetRunning() []string {
+	if m != nil {
+		return m.Running
+	}
+	return nil
+}
+
+func (m *HeartbeatRequest) GetRunId() string {
+	if m != nil {
+		return m.RunId
+	}
+	return ""
+}
+
+type HeartbeatResponse struct {
+	Abort bool `protobuf:"varint,1,opt,name=abort" json:"abort,omitempty"`
+}
+
+func (m *HeartbeatResponse) Reset()                    { *m = HeartbeatResponse{} }
+func (m *HeartbeatResponse) String() string            { return proto.CompactTextString(m) }
+func (*HeartbeatResponse) ProtoMessage()               {}
+func (*HeartbeatResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *HeartbeatResponse) GetAbort() bool {
+	if m != nil {
+		return m.Abort
+	}
+	return false
+}
+
+type ResultEvent struct {
+	Path       string                    `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	SlaveId    string                    `protobuf:"bytes,2,opt,name=slave_id,json=slaveId" json:"slave_id,omitempty"`
+	Testline   *pet.Testline             `protobuf:"bytes,3,opt,name=testline" json:"testline,omitempty"`
+	Output     []byte                    `protobuf:"bytes,4,opt,name=output,proto3" json:"output,omitempty"`
+	Testsuite  *pet.Testsuite            `protobuf:"bytes,5,opt,name=testsuite" json:"testsuite,omitempty"`
+	UserTime   *google_protobuf.Duration `protobuf:"bytes,6,opt,name=user_time,json=userTime" json:"user_time,omitempty"`
+	SystemTime *google_protobuf.Duration `protobuf:"bytes,7,opt,name=system_time,json=systemTime" json:"system_time,omitempty"`
+	Stdout     []byte                    `protobuf:"bytes,8,opt,name=stdout,proto3" json:"stdout,omitempty"`
+	Stderr     []byte                    `protobuf:"bytes,9,opt,name=stderr,proto3" json:"stderr,omitempty"`
+	RunId      string                    `protobuf:"bytes,10,opt,name=run_id,json=runId" json:"run_id,omitempty"`
+	LeaseId    int64                     `protobuf:"varint,11,opt,name=lease_id,json=leaseId" json:"lease_id,omitempty"`
+}
+
+func (m *ResultEvent) Reset()                    { *m = ResultEvent{} }
+func (m *ResultEvent) String() string            { return proto.CompactTextString(m) }
+func (*ResultEvent) ProtoMessage()               {}
+func (*ResultEvent) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *ResultEvent) GetPath() string {
+	if m != nil {
+		return m.Path
+	}
+	return ""
+}
+
+func (m *ResultEvent) GetSlaveId() string {
+	if m != nil {
+		return m.SlaveId
+	}
+	return ""
+}
+
+func (m *ResultEvent) GetTestline() *pet.Testline {
+	if m != nil {
+		return m.Testline
+	}
+	return nil
+}
+
+func (m *ResultEvent) GetOutput() []byte {
+	if m != nil {
+		return m.Output
+	}
+	return nil
+}
+
+func (m *ResultEvent) GetTestsuite() *pet.Testsuite {
+	if m != nil {
+		return m.Testsuite
+	}
+	return nil
+}
+
+func (m *ResultEvent) GetUserTime() *google_protobuf.Duration {
+	if m != nil {
+		return m.UserTime
+	}
+	return nil
+}
+
+func (m *ResultEvent) GetSystemTime() *google_protobuf.Duration {
+	if m != nil {
+		return m.SystemTime
+	}
+	return nil
+}
+
+func (m *ResultEvent) GetStdout() []byte {
+	if m != nil {
+		return m.Stdout
+	}
+	return nil
+}
+
+func (m *ResultEvent) GetStderr() []byte {
+	if m != nil {
+		return m.Stderr
+	}
+	return nil
+}
+
+func (m *ResultEvent) GetRunId() string {
+	if m != nil {
+		return m.RunId
+	}
+	return ""
+}
+
+func (m *ResultEvent) GetLeaseId() int64 {
+	if m != nil {
+		return m.LeaseId
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*GetTestRequest)(nil), "eupho.GetTestRequest")
 	proto.RegisterType((*GetTestResponse)(nil), "eupho.GetTestResponse")
 	proto.RegisterType((*ResultRequest)(nil), "eupho.ResultRequest")
 	proto.RegisterType((*ResultResponse)(nil), "eupho.ResultResponse")
+	proto.RegisterType((*RegisterRequest)(nil), "eupho.RegisterRequest")
+	proto.RegisterType((*RegisterResponse)(nil), "eupho.RegisterResponse")
+	proto.RegisterType((*HeartbeatRequest)(nil), "eupho.HeartbeatRequest")
+	proto.RegisterType((*HeartbeatResponse)(nil), "eupho.HeartbeatResponse")
+	proto.RegisterType((*ResultEvent)(nil), "eupho.ResultEvent")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -128,6 +459,9 @@ const _ = grpc.SupportPackageIsVersion4
 type EuphoClient interface {
 	GetTest(ctx context.Context, in *GetTestRequest, opts ...grpc.CallOption) (*GetTestResponse, error)
 	Result(ctx context.Context, in *ResultRequest, opts ...grpc.CallOption) (*ResultResponse, error)
+	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error)
+	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error)
+	ResultStream(ctx context.Context, opts ...grpc.CallOption) (Eupho_ResultStreamClient, error)
 }
 
 type euphoClient struct {
@@ -156,11 +490,66 @@ func (c *euphoClient) Result(ctx context.Context, in *ResultRequest, opts ...grp
 	return out, nil
 }
 
+func (c *euphoClient) Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error) {
+	out := new(RegisterResponse)
+	err := grpc.Invoke(ctx, "/eupho.Eupho/Register", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *euphoClient) Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error) {
+	out := new(HeartbeatResponse)
+	err := grpc.Invoke(ctx, "/eupho.Eupho/Heartbeat", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *euphoClient) ResultStream(ctx context.Context, opts ...grpc.CallOption) (Eupho_ResultStreamClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Eupho_serviceDesc.Streams[0], c.cc, "/eupho.Eupho/ResultStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &euphoResultStreamClient{stream}
+	return x, nil
+}
+
+type Eupho_ResultStreamClient interface {
+	Send(*ResultEvent) error
+	CloseAndRecv() (*ResultResponse, error)
+	grpc.ClientStream
+}
+
+type euphoResultStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *euphoResultStreamClient) Send(m *ResultEvent) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *euphoResultStreamClient) CloseAndRecv() (*ResultResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(ResultResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // Server API for Eupho service
 
 type EuphoServer interface {
 	GetTest(context.Context, *GetTestRequest) (*GetTestResponse, error)
 	Result(context.Context, *ResultRequest) (*ResultResponse, error)
+	Register(context.Context, *RegisterRequest) (*RegisterResponse, error)
+	Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error)
+	ResultStream(Eupho_ResultStreamServer) error
 }
 
 func RegisterEuphoServer(s *grpc.Server, srv EuphoServer) {
@@ -203,6 +592,68 @@ func _Eupho_Result_Handler(srv interface{}, ctx context.Context, dec func(interf
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Eupho_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EuphoServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/eupho.Eupho/Register",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EuphoServer).Register(ctx, req.(*RegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Eupho_Heartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HeartbeatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EuphoServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/eupho.Eupho/Heartbeat",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EuphoServer).Heartbeat(ctx, req.(*HeartbeatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Eupho_ResultStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(EuphoServer).ResultStream(&euphoResultStreamServer{stream})
+}
+
+type Eupho_ResultStreamServer interface {
+	SendAndClose(*ResultResponse) error
+	Recv() (*ResultEvent, error)
+	grpc.ServerStream
+}
+
+type euphoResultStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *euphoResultStreamServer) SendAndClose(m *ResultResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *euphoResultStreamServer) Recv() (*ResultEvent, error) {
+	m := new(ResultEvent)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 var _Eupho_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "eupho.Eupho",
 	HandlerType: (*EuphoServer)(nil),
@@ -215,28 +666,72 @@ var _Eupho_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Result",
 			Handler:    _Eupho_Result_Handler,
 		},
+		{
+			MethodName: "Register",
+			Handler:    _Eupho_Register_Handler,
+		},
+		{
+			MethodName: "Heartbeat",
+			Handler:    _Eupho_Heartbeat_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ResultStream",
+			Handler:       _Eupho_ResultStream_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "eupho.proto",
 }
 
 func init() { proto.RegisterFile("eupho.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 238 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x90, 0x41, 0x4b, 0xc3, 0x40,
-	0x10, 0x85, 0x4d, 0xb5, 0xd5, 0x9d, 0x62, 0x94, 0xc1, 0x4a, 0x08, 0x0a, 0x61, 0x41, 0xc8, 0x41,
-	0x72, 0xa8, 0x07, 0xc1, 0xbb, 0x7a, 0xf2, 0xe0, 0xd2, 0xbb, 0x58, 0x1c, 0x69, 0xa0, 0xba, 0xab,
-	0x33, 0x7b, 0xf3, 0xc7, 0xcb, 0xee, 0x36, 0x2d, 0x09, 0xbd, 0x25, 0x1f, 0x6f, 0xbf, 0x79, 0x33,
-	0x30, 0x25, 0xef, 0x56, 0xb6, 0x71, 0xbf, 0x56, 0x2c, 0x8e, 0xe3, 0x4f, 0xa9, 0x1c, 0x49, 0x22,
-	0xfa, 0x05, 0xf2, 0x67, 0x92, 0x05, 0xb1, 0x18, 0xfa, 0xf1, 0xc4, 0x82, 0x57, 0xa0, 0xd8, 0x2f,
-	0xbf, 0x5a, 0x11, 0xfa, 0x28, 0xb2, 0x2a, 0xab, 0x4f, 0xcc, 0x0e, 0xe0, 0x35, 0x80, 0x10, 0xcb,
-	0xdb, 0x67, 0xbb, 0x26, 0x2e, 0x46, 0xd5, 0x61, 0xad, 0x8c, 0x0a, 0xe4, 0x29, 0x00, 0x7d, 0x03,
-	0x67, 0x5b, 0x1d, 0x3b, 0xfb, 0xcd, 0x84, 0x08, 0x47, 0xee, 0x5d, 0x56, 0x51, 0xa5, 0x4c, 0xfc,
-	0xd6, 0xaf, 0x70, 0x6a, 0x88, 0xfd, 0x7a, 0x3b, 0x74, 0x4f, 0x08, 0x6f, 0x21, 0x8a, 0xd9, 0xb7,
-	0x42, 0xc5, 0xa8, 0xca, 0xea, 0xe9, 0x3c, 0x6f, 0x42, 0xf3, 0x45, 0x47, 0xcd, 0x2e, 0xa0, 0xcf,
-	0x21, 0xef, 0x94, 0x69, 0xf0, 0xfc, 0x0f, 0xc6, 0x8f, 0x61, 0x5d, 0x7c, 0x80, 0xe3, 0x4d, 0x29,
-	0x9c, 0x35, 0xe9, 0x1c, 0xfd, 0x9d, 0xcb, 0xcb, 0x21, 0x4e, 0x0a, 0x7d, 0x80, 0xf7, 0x30, 0x49,
-	0x5a, 0xbc, 0xd8, 0x64, 0x7a, 0xc5, 0xcb, 0xd9, 0x80, 0x76, 0x0f, 0x97, 0x93, 0x78, 0xdf, 0xbb,
-	0xff, 0x00, 0x00, 0x00, 0xff, 0xff, 0xb3, 0xfd, 0x61, 0x9e, 0x80, 0x01, 0x00, 0x00,
+	// 705 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x54, 0x4d, 0x6b, 0xdb, 0x4a,
+	0x14, 0x7d, 0xb2, 0x22, 0x4b, 0xba, 0x4e, 0x1c, 0xbf, 0x21, 0xc9, 0x53, 0xcc, 0x7b, 0x0f, 0xe3,
+	0x45, 0x51, 0xa0, 0x38, 0x90, 0x42, 0x0b, 0x81, 0x42, 0x16, 0x49, 0x9b, 0x2c, 0xba, 0x99, 0x66,
+	0x5d, 0x23, 0xa3, 0x1b, 0x5b, 0x45, 0x5f, 0x9d, 0x0f, 0x43, 0xd7, 0xfd, 0x35, 0xfd, 0x0f, 0x5d,
+	0xf5, 0x17, 0xf4, 0x27, 0x95, 0x19, 0x49, 0x63, 0x29, 0xa9, 0x13, 0xc8, 0x4e, 0xf7, 0x6a, 0xee,
+	0xe1, 0xcc, 0xb9, 0xe7, 0x0c, 0x0c, 0x50, 0x96, 0xab, 0x62, 0x56, 0xb2, 0x42, 0x14, 0xc4, 0xd1,
+	0xc5, 0xd8, 0x2f, 0x51, 0x54, 0x9d, 0xf1, 0xff, 0xcb, 0xa2, 0x58, 0xa6, 0x78, 0xaa, 0xab, 0x85,
+	0xbc, 0x3b, 0x8d, 0x25, 0x8b, 0x44, 0x52, 0xe4, 0xd5, 0xff, 0xe9, 0x77, 0x0b, 0x86, 0xef, 0x51,
+	0xdc, 0x22, 0x17, 0x14, 0xbf, 0x48, 0xe4, 0x82, 0xfc, 0x0b, 0x3e, 0x97, 0x8b, 0x2c, 0x11, 0x02,
+	0xe3, 0xc0, 0x9a, 0x58, 0xa1, 0x47, 0x37, 0x0d, 0xf2, 0x1f, 0x80, 0x40, 0x2e, 0xe6, 0x77, 0x49,
+	0x8a, 0x3c, 0xe8, 0x4d, 0xec, 0xd0, 0xa7, 0xbe, 0xea, 0xbc, 0x53, 0x0d, 0x72, 0x0c, 0x1e, 0x4f,
+	0xa3, 0x35, 0xce, 0x93, 0x38, 0xb0, 0x27, 0x56, 0xe8, 0x53, 0x57, 0xd7, 0x37, 0x31, 0x09, 0x61,
+	0x64, 0x26, 0xe7, 0x99, 0x48, 0x32, 0xe4, 0xc1, 0xce, 0xc4, 0x0e, 0x6d, 0x3a, 0x6c, 0xe6, 0x3f,
+	0xe8, 0x2e, 0x39, 0x84, 0x3e, 0x93, 0xb9, 0x82, 0x70, 0x34, 0x84, 0xc3, 0x64, 0x7e, 0x13, 0x4f,
+	0x2f, 0x60, 0xdf, 0x50, 0xe5, 0x65, 0x91, 0x73, 0x24, 0x04, 0x76, 0xca, 0x48, 0xac, 0x34, 0x4d,
+	0x9f, 0xea, 0x6f, 0x45, 0x21, 0xc5, 0x88, 0x6b, 0x0a, 0xbd, 0x89, 0x15, 0xda, 0xd4, 0xd5, 0xf5,
+	0x4d, 0x3c, 0xfd, 0xd9, 0x83, 0x3d, 0x8a, 0x5c, 0xa6, 0xe6, 0xb2, 0x7f, 0x02, 0x78, 0x09, 0xfa,
+	0x42, 0x5c, 0x26, 0x02, 0x35, 0xc2, 0xe0, 0x6c, 0x38, 0x53, 0x92, 0xde, 0x36, 0x5d, 0xba, 0x39,
+	0xf0, 0xd8, 0x8d, 0x5f, 0x83, 0x2f, 0x39, 0xb2, 0xb9, 0xba, 0x55, 0xb0, 0xa3, 0x81, 0x8e, 0x67,
+	0xd5, 0x42, 0x66, 0xcd, 0x42, 0x66, 0x97, 0xf5, 0x42, 0xa8, 0xa7, 0xce, 0xde, 0x26, 0x19, 0x92,
+	0x73, 0x18, 0xf0, 0xaf, 0x5c, 0x60, 0x56, 0x4d, 0x3a, 0x4f, 0x4d, 0x42, 0x75, 0x5a, 0xcf, 0x1e,
+	0x41, 0x9f, 0x8b, 0xb8, 0x90, 0x22, 0xe8, 0x4f, 0xac, 0x70, 0x97, 0xd6, 0x55, 0xdd, 0x47, 0xc6,
+	0x02, 0xd7, 0xf4, 0x91, 0xb1, 0x96, 0xd6, 0x5e, 0x4b, 0xeb, 0x8e, 0x88, 0x7e, 0x57, 0xc4, 0x11,
+	0x0c, 0x1b, 0x0d, 0xab, 0x2d, 0x4c, 0x7f, 0x59, 0xb0, 0x4f, 0x71, 0x99, 0x70, 0x81, 0xac, 0x11,
+	0x76, 0x0c, 0xde, 0xaa, 0xe0, 0x22, 0x8f, 0x32, 0xac, 0xc5, 0x35, 0xb5, 0x12, 0xfd, 0x73, 0xb1,
+	0xe0, 0x5a, 0x5b, 0x87, 0xea, 0x6f, 0x12, 0x80, 0x5b, 0xa6, 0x72, 0x99, 0xe4, 0x3c, 0xb0, 0xb5,
+	0xa9, 0x9a, 0x52, 0xfd, 0x59, 0x23, 0xe3, 0x49, 0x91, 0x6b, 0x0d, 0x7d, 0xda, 0x94, 0xe4, 0x05,
+	0xec, 0x6f, 0xbc, 0x38, 0x5f, 0x45, 0x7c, 0x55, 0x1b, 0x66, 0xcf, 0x18, 0xf2, 0x3a, 0xe2, 0x2b,
+	0xc5, 0x85, 0xe1, 0x3a, 0xd1, 0x10, 0xfd, 0x8a, 0x4b, 0x53, 0xb7, 0xee, 0xef, 0xb6, 0xbd, 0x76,
+	0x09, 0xa3, 0xcd, 0x8d, 0x6a, 0xb3, 0xb5, 0x37, 0x6d, 0x75, 0x37, 0xbd, 0x41, 0xe9, 0xb5, 0x51,
+	0x3e, 0xc1, 0xe8, 0x1a, 0x23, 0x26, 0x16, 0x18, 0x19, 0xc7, 0x3d, 0x82, 0x12, 0x80, 0xcb, 0x64,
+	0x9e, 0x27, 0xf9, 0xb2, 0x0e, 0x56, 0x53, 0xb6, 0xf0, 0xed, 0x36, 0xfe, 0x09, 0xfc, 0xdd, 0xc2,
+	0xaf, 0x69, 0x1e, 0x80, 0x13, 0x2d, 0x0a, 0x26, 0xea, 0xec, 0x56, 0xc5, 0xf4, 0x9b, 0x0d, 0x83,
+	0x6a, 0x6d, 0x57, 0x6b, 0xcc, 0xc5, 0xb6, 0xe4, 0x18, 0x6a, 0xbd, 0x2e, 0xb5, 0x13, 0xf0, 0x94,
+	0xa6, 0x69, 0x92, 0xa3, 0xa6, 0x30, 0x38, 0xdb, 0x33, 0x91, 0x50, 0x4d, 0x6a, 0x7e, 0x2b, 0xa7,
+	0x15, 0x52, 0x94, 0x52, 0xe8, 0x75, 0xed, 0xd2, 0xba, 0xea, 0xc6, 0xca, 0x79, 0x2a, 0x56, 0x9d,
+	0xec, 0xf4, 0x9f, 0x9d, 0x1d, 0xf7, 0x79, 0xd9, 0xf1, 0xb6, 0x64, 0xc7, 0xdf, 0x92, 0x1d, 0xd8,
+	0x96, 0x9d, 0x41, 0x27, 0x3b, 0x67, 0x3f, 0x7a, 0xe0, 0x5c, 0xa9, 0x37, 0x9a, 0x9c, 0x83, 0x5b,
+	0x3f, 0x66, 0xe4, 0x70, 0x56, 0xbd, 0xe1, 0xdd, 0x77, 0x78, 0x7c, 0x74, 0xbf, 0x5d, 0xa7, 0xed,
+	0x2f, 0xf2, 0x06, 0xfa, 0xd5, 0x2a, 0xc9, 0x41, 0x7d, 0xa6, 0xf3, 0xa8, 0x8d, 0x0f, 0xef, 0x75,
+	0xcd, 0xe0, 0x5b, 0xf0, 0x1a, 0x57, 0x93, 0x23, 0x73, 0xa8, 0x13, 0xdc, 0xf1, 0x3f, 0x0f, 0xfa,
+	0x66, 0xfc, 0x02, 0x7c, 0x63, 0x37, 0xd2, 0x9c, 0xbb, 0x6f, 0xf0, 0x71, 0xf0, 0xf0, 0x47, 0x8b,
+	0xc0, 0x6e, 0x45, 0xea, 0xa3, 0x60, 0x18, 0x65, 0x84, 0x74, 0x98, 0x6a, 0x67, 0x6e, 0x65, 0x1f,
+	0x5a, 0x8b, 0xbe, 0xde, 0xdf, 0xab, 0xdf, 0x03, 0x00, 0x84, 0x83, 0xae, 0x82, 0xf5, 0x06, 0x00,
+	0x00,
 }
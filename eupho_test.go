@@ -8,9 +8,15 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/mix3/eupho"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func newTempFiles(files map[string]string) (string, error) {
@@ -71,23 +77,29 @@ done_testing;`,
 	}
 
 	//<?xml version="1.0" encoding="UTF-8"?>
-	//<testsuites>
+	//<testsuites tests="1" failures="0" errors="0" skipped="0">
 	//    <testsuite tests="1" failures="0" errors="0" skipped="0" time="0.302" name="_var_folders_qf_mkfd3g0n6zn71mmr84g_qhg80000gp_T_130265267_01_t">
 	//        <properties></properties>
 	//        <testcase classname="_var_folders_qf_mkfd3g0n6zn71mmr84g_qhg80000gp_T_130265267_01_t" name="" time="0.302">
 	//            <system-out><![CDATA[ok 1
 	//]]></system-out>
 	//        </testcase>
+	//        <system-out><![CDATA[ok 1
+	//1..1
+	//]]></system-out>
 	//    </testsuite>
 	//</testsuites>
 
-	ok, err := regexp.Match(`<testsuites>
+	ok, err := regexp.Match(`<testsuites tests="1" failures="0" errors="0" skipped="0">
     <testsuite tests="1" failures="0" errors="0" skipped="0" time="[0-9\.]+" name="[^"]*">
         <properties></properties>
         <testcase classname="[^"]*" name="" time="[0-9\.]+">
             <system-out><!\[CDATA\[ok 1
 \]\]></system-out>
         </testcase>
+        <system-out><!\[CDATA\[ok 1
+1\.\.1
+\]\]></system-out>
     </testsuite>
 </testsuites>`, []byte(out))
 	if err != nil {
@@ -140,7 +152,7 @@ done_testing;`,
 		t.Errorf("ExitCode want 1, but got %d\n", code)
 	}
 
-	//<testsuites>
+	//<testsuites tests="2" failures="2" errors="0" skipped="0">
 	//    <testsuite tests="2" failures="2" errors="0" skipped="0" time="0.082" name="_var_folders_qf_mkfd3g0n6zn71mmr84g_qhg80000gp_T_230494120_01_t">
 	//        <properties></properties>
 	//        <testcase classname="_var_folders_qf_mkfd3g0n6zn71mmr84g_qhg80000gp_T_230494120_01_t" name="" time="0.082">
@@ -153,10 +165,16 @@ done_testing;`,
 	//            <system-out><![CDATA[not ok 2 - Test died with return code 1
 	//]]></system-out>
 	//        </testcase>
+	//        <system-out><![CDATA[not ok 1
+	//1..1
+	//]]></system-out>
+	//        <system-err><![CDATA[#   Failed test at /tmp/230494120/01.t line 2.
+	//# Looks like you failed 1 test of 1.
+	//]]></system-err>
 	//    </testsuite>
 	//</testsuites>
 
-	ok, err := regexp.Match(`<testsuites>
+	ok, err := regexp.Match(`<testsuites tests="2" failures="2" errors="0" skipped="0">
     <testsuite tests="2" failures="2" errors="0" skipped="0" time="[0-9\.]+" name="[^"]*">
         <properties></properties>
         <testcase classname="[^"]*" name="" time="[0-9\.]+">
@@ -169,6 +187,12 @@ done_testing;`,
             <system-out><!\[CDATA\[not ok 2 - Test died with return code 1
 \]\]></system-out>
         </testcase>
+        <system-out><!\[CDATA\[not ok 1
+1\.\.1
+\]\]></system-out>
+        <system-err><!\[CDATA\[#   Failed test at [^\n]*01\.t line 2\.
+# Looks like you failed 1 test of 1\.
+\]\]></system-err>
     </testsuite>
 </testsuites>`, []byte(out))
 	if err != nil {
@@ -204,23 +228,29 @@ done_testing;`,
 		t.Errorf("ExitCode want 0, but got %d\n", code)
 	}
 
-	//<testsuites>
+	//<testsuites tests="1" failures="0" errors="0" skipped="0">
 	//    <testsuite tests="1" failures="0" errors="0" skipped="0" time="0.106" name="_var_folders_qf_mkfd3g0n6zn71mmr84g_qhg80000gp_T_100549956_01_t">
 	//        <properties></properties>
 	//        <testcase classname="_var_folders_qf_mkfd3g0n6zn71mmr84g_qhg80000gp_T_100549956_01_t" name="" time="0.106">
 	//            <system-out><![CDATA[ok 1
 	//]]></system-out>
 	//        </testcase>
+	//        <system-out><![CDATA[ok 1
+	//1..1
+	//]]></system-out>
 	//    </testsuite>
 	//</testsuites>
 
-	ok, err := regexp.Match(`<testsuites>
+	ok, err := regexp.Match(`<testsuites tests="1" failures="0" errors="0" skipped="0">
     <testsuite tests="1" failures="0" errors="0" skipped="0" time="[0-9\.]+" name="[^"]*">
         <properties></properties>
         <testcase classname="[^"]*" name="" time="[0-9\.]+">
             <system-out><!\[CDATA\[ok 1
 \]\]></system-out>
         </testcase>
+        <system-out><!\[CDATA\[ok 1
+1\.\.1
+\]\]></system-out>
     </testsuite>
 </testsuites>`, []byte(out))
 	if err != nil {
@@ -256,7 +286,7 @@ done_testing;`,
 		t.Errorf("ExitCode want 1, but got %d\n", code)
 	}
 
-	//<testsuites>
+	//<testsuites tests="2" failures="2" errors="0" skipped="0">
 	//    <testsuite tests="2" failures="2" errors="0" skipped="0" time="0.121" name="_var_folders_qf_mkfd3g0n6zn71mmr84g_qhg80000gp_T_990018842_01_t">
 	//        <properties></properties>
 	//        <testcase classname="_var_folders_qf_mkfd3g0n6zn71mmr84g_qhg80000gp_T_990018842_01_t" name="" time="0.121">
@@ -269,10 +299,16 @@ done_testing;`,
 	//            <system-out><![CDATA[not ok 2 - Test died with return code 1
 	//]]></system-out>
 	//        </testcase>
+	//        <system-out><![CDATA[not ok 1
+	//1..1
+	//]]></system-out>
+	//        <system-err><![CDATA[#   Failed test at /tmp/230494120/01.t line 2.
+	//# Looks like you failed 1 test of 1.
+	//]]></system-err>
 	//    </testsuite>
 	//</testsuites>
 
-	ok, err := regexp.Match(`<testsuites>
+	ok, err := regexp.Match(`<testsuites tests="2" failures="2" errors="0" skipped="0">
     <testsuite tests="2" failures="2" errors="0" skipped="0" time="[0-9\.]+" name="[^"]*">
         <properties></properties>
         <testcase classname="[^"]*" name="" time="[0-9\.]+">
@@ -285,6 +321,12 @@ done_testing;`,
             <system-out><!\[CDATA\[not ok 2 - Test died with return code 1
 \]\]></system-out>
         </testcase>
+        <system-out><!\[CDATA\[not ok 1
+1\.\.1
+\]\]></system-out>
+        <system-err><!\[CDATA\[#   Failed test at [^\n]*01\.t line 2\.
+# Looks like you failed 1 test of 1\.
+\]\]></system-err>
     </testsuite>
 </testsuites>`, []byte(out))
 	if err != nil {
@@ -295,6 +337,122 @@ done_testing;`,
 	}
 }
 
+func TestSoloRunContext(t *testing.T) {
+	dir, err := newTempFiles(map[string]string{
+		`01.t`: `print "1..1\nok 1\n";`,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	c := eupho.DefaultSoloConfig()
+	c.Quiet = true
+	c.Formatter = []string{"json:" + filepath.Join(dir, "report.json")}
+	c.Args = []string{dir}
+	s, err := eupho.NewSoloWithConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := s.RunContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ExitCode != 0 {
+		t.Errorf("ExitCode want 0, but got %d\n", res.ExitCode)
+	}
+	if len(res.Results) != 1 || res.Tests != 1 || !res.Ok() {
+		t.Errorf("want 1 passed test file\ngot %+v", res)
+	}
+
+	// a missing test file is an error instead of a panic or a timeout
+	c.Args = []string{filepath.Join(dir, "missing.t")}
+	s, err = eupho.NewSoloWithConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RunContext(context.Background()); err == nil {
+		t.Error("want an error for a missing test file")
+	}
+}
+
+func TestSlaveRunContext_aborted(t *testing.T) {
+	dir, err := newTempFiles(map[string]string{
+		`01.t`: `sleep 10; print "1..1\nok 1\n";`,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	mc := eupho.DefaultMasterConfig()
+	mc.Addr = addr
+	mc.Quiet = true
+	mc.Formatter = []string{"json:" + filepath.Join(dir, "report.json")}
+	m, err := eupho.NewMasterWithConfig(mc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go m.RunContext(context.Background())
+	defer m.Abort()
+
+	sc := eupho.DefaultSlaveConfig()
+	sc.Addr = addr
+	sc.Quiet = true
+	sc.Args = []string{dir}
+	s, err := eupho.NewSlaveWithConfig(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.RunContext(ctx); err != eupho.ErrAborted {
+		t.Errorf("want ErrAborted\ngot %v", err)
+	}
+}
+
+func TestParseArgs_errors(t *testing.T) {
+	if err := eupho.NewMaster().ParseArgs([]string{"--help"}); !eupho.IsHelp(err) {
+		t.Errorf("want the help\ngot %v", err)
+	}
+
+	err := eupho.NewMaster().ParseArgs([]string{"--formatter", "unknown"})
+	if e, ok := err.(*eupho.ConfigError); !ok || e.Option != "formatter" {
+		t.Errorf("want a ConfigError of --formatter\ngot %#v", err)
+	}
+
+	c := eupho.DefaultSlaveConfig()
+	c.PluginArgs = []string{"unknown"}
+	if _, err := eupho.NewSlaveWithConfig(c); err == nil {
+		t.Error("want an error for an unknown plugin")
+	}
+
+	// the address is in use
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	mc := eupho.DefaultMasterConfig()
+	mc.Addr = l.Addr().String()
+	m, err := eupho.NewMasterWithConfig(mc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := m.RunContext(context.Background()); err == nil || res != nil {
+		t.Errorf("want an error for the address in use\ngot %v, %v", res, err)
+	}
+}
+
 // https://gist.github.com/mindscratch/0faa78bd3c0005d080bf
 // not thread safe
 func captureStdout(f func()) string {
@@ -311,3 +469,170 @@ func captureStdout(f func()) string {
 	io.Copy(&buf, r)
 	return buf.String()
 }
+
+func TestWithConfig_zero(t *testing.T) {
+	dir, err := newTempFiles(map[string]string{
+		`01.t`: `print "1..1\nok 1\n";`,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	// configs built by hand take the defaults for the values left zero
+	m, err := eupho.NewMasterWithConfig(eupho.MasterConfig{
+		Addr:      addr,
+		Quiet:     true,
+		Formatter: []string{"json:" + filepath.Join(dir, "master.json")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := eupho.NewSlaveWithConfig(eupho.SlaveConfig{Addr: addr, Quiet: true, Args: []string{dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.RunContext(context.Background())
+	res, err := m.RunContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Results) != 1 || !res.Ok() || res.ExitCode != 0 {
+		t.Errorf("want 1 passed test file\ngot %+v", res)
+	}
+
+	solo, err := eupho.NewSoloWithConfig(eupho.SoloConfig{
+		Quiet:     true,
+		Formatter: []string{"json:" + filepath.Join(dir, "solo.json")},
+		Args:      []string{dir},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = solo.RunContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Results) != 1 || !res.Ok() || res.ExitCode != 0 {
+		t.Errorf("want 1 passed test file\ngot %+v", res)
+	}
+
+	// negative values are errors
+	for option, err := range map[string]error{
+		"lease-timeout": func() error {
+			_, err := eupho.NewMasterWithConfig(eupho.MasterConfig{LeaseTimeout: -time.Second})
+			return err
+		}(),
+		"slave-timeout": func() error {
+			_, err := eupho.NewMasterWithConfig(eupho.MasterConfig{SlaveTimeout: -time.Second})
+			return err
+		}(),
+		"heartbeat": func() error {
+			_, err := eupho.NewSlaveWithConfig(eupho.SlaveConfig{Heartbeat: -time.Second})
+			return err
+		}(),
+		"test-timeout": func() error {
+			_, err := eupho.NewSlaveWithConfig(eupho.SlaveConfig{TestTimeout: -time.Second})
+			return err
+		}(),
+		"capture-limit": func() error {
+			_, err := eupho.NewSlaveWithConfig(eupho.SlaveConfig{CaptureLimit: -1})
+			return err
+		}(),
+	} {
+		if e, ok := err.(*eupho.ConfigError); !ok || e.Option != option {
+			t.Errorf("want a ConfigError of --%s\ngot %#v", option, err)
+		}
+	}
+}
+
+// legacyMaster hands out the test files like a master older than Register,
+// heartbeats and result streams.
+type legacyMaster struct {
+	mu      sync.Mutex
+	files   []string
+	results map[string]bool
+}
+
+func (m *legacyMaster) GetTest(ctx context.Context, req *eupho.GetTestRequest) (*eupho.GetTestResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !req.Submitted {
+		m.files = append(m.files, req.TestFiles...)
+	}
+	if len(m.files) == 0 {
+		return &eupho.GetTestResponse{}, nil
+	}
+	path := m.files[0]
+	m.files = m.files[1:]
+	return &eupho.GetTestResponse{Path: path}, nil
+}
+
+func (m *legacyMaster) Result(ctx context.Context, req *eupho.ResultRequest) (*eupho.ResultResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.results[req.Path] = req.Testsuite.Ok
+	return &eupho.ResultResponse{}, nil
+}
+
+func (m *legacyMaster) Register(ctx context.Context, req *eupho.RegisterRequest) (*eupho.RegisterResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unknown method Register")
+}
+
+func (m *legacyMaster) Heartbeat(ctx context.Context, req *eupho.HeartbeatRequest) (*eupho.HeartbeatResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unknown method Heartbeat")
+}
+
+func (m *legacyMaster) ResultStream(stream eupho.Eupho_ResultStreamServer) error {
+	return status.Error(codes.Unimplemented, "unknown method ResultStream")
+}
+
+func TestSlave_legacyMaster(t *testing.T) {
+	dir, err := newTempFiles(map[string]string{
+		`01.t`: `print "1..1\nok 1\n";`,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &legacyMaster{results: map[string]bool{}}
+	server := grpc.NewServer()
+	eupho.RegisterEuphoServer(server, m)
+	go server.Serve(l)
+	defer server.Stop()
+
+	c := eupho.DefaultSlaveConfig()
+	c.Addr = l.Addr().String()
+	c.Quiet = true
+	c.MaxRetry = 2
+	c.Args = []string{dir}
+	s, err := eupho.NewSlaveWithConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.RunContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ok, sent := m.results[filepath.Join(dir, "01.t")]; len(m.results) != 1 || !sent || !ok {
+		t.Errorf("want the result of 01.t to be sent with Result\ngot %v", m.results)
+	}
+}
@@ -1,6 +1,19 @@
 package eupho
 
-import "github.com/mix3/eupho/test"
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mix3/eupho/formatter"
+	"github.com/mix3/eupho/test"
+)
 
 type Formatter interface {
 	// Called to create a new test
@@ -8,4 +21,228 @@ type Formatter interface {
 
 	// Prints the report after all tests are run
 	Report()
+
+	// Sets where the report is printed
+	SetOutput(w io.Writer)
+}
+
+// ProgressFormatter is a Formatter which also shows the result of each test
+// as soon as it arrives.
+type ProgressFormatter interface {
+	Formatter
+
+	// Called when the final result of a test arrives, with the number of
+	// finished tests and the number of all tests
+	Progress(test *test.Test, done, total int)
+}
+
+// ResultFormatter is a Formatter which also receives the whole result of the
+// run before Report.
+type ResultFormatter interface {
+	Formatter
+
+	// Called before Report with the result of the run
+	SetResult(res *RunResult)
+}
+
+// OutputChecker is a Formatter which does not accept every destination, such
+// as one which cannot print to the standard output.
+type OutputChecker interface {
+	Formatter
+
+	// Called before the run with whether a path to print to was given
+	CheckOutput(toFile bool) error
+}
+
+// multiFormatter passes the results to several formatters.
+type multiFormatter []Formatter
+
+func (mf multiFormatter) OpenTest(test *test.Test) {
+	for _, f := range mf {
+		f.OpenTest(test)
+	}
+}
+
+func (mf multiFormatter) Report() {
+	for _, f := range mf {
+		f.Report()
+	}
+}
+
+func (mf multiFormatter) SetOutput(w io.Writer) {
+	for _, f := range mf {
+		f.SetOutput(w)
+	}
+}
+
+func (mf multiFormatter) Progress(test *test.Test, done, total int) {
+	for _, f := range mf {
+		if pf, ok := f.(ProgressFormatter); ok {
+			pf.Progress(test, done, total)
+		}
+	}
+}
+
+func (mf multiFormatter) SetResult(res *RunResult) {
+	for _, f := range mf {
+		if rf, ok := f.(ResultFormatter); ok {
+			rf.SetResult(res)
+		}
+	}
+}
+
+type FormatterLoader interface {
+	Load(name, args string) (Formatter, error)
+}
+
+type FormatterLoaderFunc func(name, args string) (Formatter, error)
+
+func (f FormatterLoaderFunc) Load(name, args string) (Formatter, error) {
+	return f(name, args)
+}
+
+var formatterLoaders map[string]FormatterLoader = map[string]FormatterLoader{}
+
+func AppendFormatterLoader(name string, loader FormatterLoader) {
+	formatterLoaders[name] = loader
+}
+
+func init() {
+	AppendFormatterLoader("console", FormatterLoaderFunc(func(name, args string) (Formatter, error) {
+		return &formatter.ConsoleFormatter{Start: time.Now()}, nil
+	}))
+	AppendFormatterLoader("tap", FormatterLoaderFunc(func(name, args string) (Formatter, error) {
+		return &formatter.TapFormatter{}, nil
+	}))
+	AppendFormatterLoader("junit", FormatterLoaderFunc(func(name, args string) (Formatter, error) {
+		opts, err := formatter.ParseJUnitOptions(args)
+		if err != nil {
+			return nil, err
+		}
+		return &formatter.JUnitFormatter{Options: opts}, nil
+	}))
+	AppendFormatterLoader("json", FormatterLoaderFunc(func(name, args string) (Formatter, error) {
+		return &formatter.JSONFormatter{}, nil
+	}))
+	AppendFormatterLoader("ndjson", FormatterLoaderFunc(func(name, args string) (Formatter, error) {
+		return &formatter.NDJSONFormatter{}, nil
+	}))
+	AppendFormatterLoader("html", FormatterLoaderFunc(func(name, args string) (Formatter, error) {
+		return &formatter.HTMLFormatter{Start: time.Now()}, nil
+	}))
+	AppendFormatterLoader("tap-archive", FormatterLoaderFunc(func(name, args string) (Formatter, error) {
+		return &formatter.TAPArchiveFormatter{Dir: args, Start: time.Now()}, nil
+	}))
+}
+
+// formatterNames returns the names of the available formatters.
+func formatterNames() []string {
+	names := make([]string, 0, len(formatterLoaders))
+	for name := range formatterLoaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// describeFormatters lists the available formatters in the help of the
+// --formatter option.
+func describeFormatters(parser *flags.Parser) {
+	if opt := parser.FindOptionByLongName("formatter"); opt != nil {
+		opt.Description += " (available: " + strings.Join(formatterNames(), ", ") + ")"
+	}
+}
+
+// parseFormatterSpec splits a formatter given as "name[=args][:path]". The
+// path is everything after the first ":" which is not escaped as "\:" in the
+// args, so it may contain colons itself, e.g. "json:C:\out\eupho.json".
+func parseFormatterSpec(spec string) (name, args, path string) {
+	i := strings.IndexAny(spec, "=:")
+	if i < 0 {
+		return spec, "", ""
+	}
+	name, rest := spec[:i], spec[i+1:]
+	if spec[i] == ':' {
+		return name, "", rest
+	}
+
+	var b bytes.Buffer
+	for j := 0; j < len(rest); j++ {
+		switch {
+		case strings.HasPrefix(rest[j:], `\:`):
+			b.WriteByte(':')
+			j++
+		case rest[j] == ':':
+			return name, b.String(), rest[j+1:]
+		default:
+			b.WriteByte(rest[j])
+		}
+	}
+	return name, b.String(), ""
+}
+
+// checkFormatters reports a formatter which is not registered.
+func checkFormatters(specs []string) error {
+	for _, spec := range specs {
+		name, _, _ := parseFormatterSpec(spec)
+		if _, ok := formatterLoaders[name]; !ok {
+			return fmt.Errorf("unknown formatter: %s (available: %s)", name, strings.Join(formatterNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// openFormatters loads the formatters given as "name[=args][:path]". A
+// formatter without a path prints to the standard output.
+func openFormatters(specs []string) (Formatter, []io.Closer, error) {
+	if len(specs) == 0 {
+		specs = []string{"console"}
+	}
+	if err := checkFormatters(specs); err != nil {
+		return nil, nil, err
+	}
+
+	mf := multiFormatter{}
+	closers := []io.Closer{}
+	for _, spec := range specs {
+		name, args, path := parseFormatterSpec(spec)
+		f, err := formatterLoaders[name].Load(name, args)
+		if err != nil {
+			closeAll(closers)
+			return nil, nil, fmt.Errorf("formatter %s: %v", name, err)
+		}
+		if oc, ok := f.(OutputChecker); ok {
+			if err := oc.CheckOutput(path != ""); err != nil {
+				closeAll(closers)
+				return nil, nil, fmt.Errorf("formatter %s: %v", name, err)
+			}
+		}
+		if path != "" {
+			w, err := createOutput(path)
+			if err != nil {
+				closeAll(closers)
+				return nil, nil, err
+			}
+			f.SetOutput(w)
+			closers = append(closers, w)
+		}
+		mf = append(mf, f)
+	}
+	if len(mf) == 1 {
+		return mf[0], closers, nil
+	}
+	return mf, closers, nil
+}
+
+func createOutput(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
+
+func closeAll(closers []io.Closer) {
+	for _, c := range closers {
+		c.Close()
+	}
 }
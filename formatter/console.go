@@ -0,0 +1,194 @@
+package formatter
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mix3/eupho/test"
+	pet "gopkg.in/mix3/pet.v3"
+)
+
+// ConsoleFormatter prints the results in the style of prove: a line per test
+// file as soon as its result arrives, followed by a summary of the failures.
+type ConsoleFormatter struct {
+	// Start is when the run started, used to show the wallclock time.
+	Start time.Time
+
+	Tests []*test.Test
+
+	// Result is the whole result of the run, given by SetResult.
+	Result *RunResult
+
+	out io.Writer
+}
+
+func (f *ConsoleFormatter) SetOutput(w io.Writer) {
+	f.out = w
+}
+
+func (f *ConsoleFormatter) OpenTest(test *test.Test) {
+	f.Tests = append(f.Tests, test)
+}
+
+func (f *ConsoleFormatter) SetResult(res *RunResult) {
+	f.Result = res
+}
+
+func (f *ConsoleFormatter) Progress(test *test.Test, done, total int) {
+	out := outputOf(f.out)
+	fmt.Fprintf(out, "[%d/%d] %s .. %s\n", done, total, test.Path, f.status(test))
+	if !test.Suite.Ok {
+		printOutput(out, "STDOUT", test.Stdout)
+		printOutput(out, "STDERR", test.Stderr)
+	}
+}
+
+// printOutput prints the captured output of a failed test file indented.
+func printOutput(out io.Writer, name string, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "  %s:\n", name)
+	for _, line := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+		fmt.Fprintf(out, "    %s\n", line)
+	}
+}
+
+func (f *ConsoleFormatter) status(test *test.Test) string {
+	suite := test.Suite
+	if suite.Ok {
+		if test.Flaky {
+			return fmt.Sprintf("ok (passed on attempt %d)", test.Attempts)
+		}
+		return "ok"
+	}
+	if len(suite.Tests) == 0 {
+		return "No subtests run"
+	}
+	failed := failedTests(suite)
+	if len(failed) == 0 {
+		return "Dubious"
+	}
+	return fmt.Sprintf("Failed %d/%d subtests", len(failed), len(suite.Tests))
+}
+
+func (f *ConsoleFormatter) Report() {
+	out := outputOf(f.out)
+
+	tests := make([]*test.Test, len(f.Tests))
+	copy(tests, f.Tests)
+	sort.Slice(tests, func(i, j int) bool { return tests[i].Path < tests[j].Path })
+
+	ok := true
+	count := 0
+	var cusr, csys time.Duration
+	for _, t := range tests {
+		count += len(t.Suite.Tests)
+		cusr += t.UserTime
+		csys += t.SystemTime
+		if !t.Suite.Ok {
+			ok = false
+		}
+	}
+	notFinished := []string{}
+	if res := f.Result; res != nil {
+		notFinished = append(notFinished, res.NotFinished...)
+		sort.Strings(notFinished)
+		if !res.Ok() || res.ExitCode != 0 {
+			ok = false
+		}
+	}
+
+	fmt.Fprintln(out)
+	if ok {
+		fmt.Fprintln(out, "All tests successful.")
+	} else {
+		fmt.Fprintln(out, "Test Summary Report")
+		fmt.Fprintln(out, "-------------------")
+		for _, t := range tests {
+			f.summary(out, t)
+		}
+		for _, path := range notFinished {
+			fmt.Fprintf(out, "%s (Not finished)\n", path)
+			fmt.Fprintln(out, "  Test did not finish, e.g. the run timed out or was aborted")
+		}
+	}
+
+	var wallclock time.Duration
+	if !f.Start.IsZero() {
+		wallclock = time.Since(f.Start)
+	}
+	fmt.Fprintf(
+		out,
+		"Files=%d, Tests=%d, %2d wallclock secs (%5.2f cusr %5.2f csys = %5.2f CPU)\n",
+		len(tests), count, int(wallclock.Seconds()),
+		cusr.Seconds(), csys.Seconds(), (cusr + csys).Seconds(),
+	)
+	if ok {
+		fmt.Fprintln(out, "Result: PASS")
+	} else {
+		fmt.Fprintln(out, "Result: FAIL")
+	}
+}
+
+// summary prints why a test file failed, and the TODO tests which passed.
+func (f *ConsoleFormatter) summary(out io.Writer, t *test.Test) {
+	suite := t.Suite
+	failed := failedTests(suite)
+	todo := []int32{}
+	for _, line := range suite.Tests {
+		if line.Ok && line.Directive == pet.Testline_TODO {
+			todo = append(todo, line.Num)
+		}
+	}
+	if suite.Ok && len(todo) == 0 {
+		return
+	}
+
+	fmt.Fprintf(out, "%s (Tests: %d Failed: %d)\n", t.Path, len(suite.Tests), len(failed))
+	if len(failed) == 1 {
+		fmt.Fprintf(out, "  Failed test:  %s\n", numRanges(failed))
+	} else if len(failed) > 1 {
+		fmt.Fprintf(out, "  Failed tests:  %s\n", numRanges(failed))
+	}
+	if len(todo) > 0 {
+		fmt.Fprintf(out, "  TODO passed:   %s\n", numRanges(todo))
+	}
+	if suite.Plan < 0 {
+		fmt.Fprintln(out, "  Parse errors: No plan found in TAP output")
+	} else if int(suite.Plan) != len(suite.Tests) {
+		fmt.Fprintf(out, "  Parse errors: Bad plan.  You planned %d tests but ran %d.\n", suite.Plan, len(suite.Tests))
+	}
+}
+
+// failedTests returns the numbers of the failed tests, except TODO tests.
+func failedTests(suite *pet.Testsuite) []int32 {
+	failed := []int32{}
+	for _, line := range suite.Tests {
+		if !line.Ok && line.Directive != pet.Testline_TODO {
+			failed = append(failed, line.Num)
+		}
+	}
+	return failed
+}
+
+// numRanges formats test numbers like "1-3, 5".
+func numRanges(nums []int32) string {
+	ranges := []string{}
+	for i := 0; i < len(nums); {
+		j := i
+		for j+1 < len(nums) && nums[j+1] == nums[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, fmt.Sprintf("%d", nums[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", nums[i], nums[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ", ")
+}
@@ -0,0 +1,138 @@
+package formatter_test
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/mix3/eupho/formatter"
+	"github.com/mix3/eupho/test"
+	pet "gopkg.in/mix3/pet.v3"
+)
+
+func TestConsole_pass(t *testing.T) {
+	var buf bytes.Buffer
+	cf := &formatter.ConsoleFormatter{Start: time.Now()}
+	cf.SetOutput(&buf)
+
+	test := &test.Test{
+		Path: "t/01.t",
+		Suite: &pet.Testsuite{
+			Ok:    true,
+			Plan:  1,
+			Tests: []*pet.Testline{{Ok: true, Num: 1}},
+		},
+		UserTime:   100 * time.Millisecond,
+		SystemTime: 20 * time.Millisecond,
+	}
+	cf.Progress(test, 1, 1)
+	cf.OpenTest(test)
+	cf.Report()
+
+	re := `^\[1/1\] t/01.t .. ok\n\n` +
+		`All tests successful.\n` +
+		`Files=1, Tests=1,  0 wallclock secs \( 0.10 cusr  0.02 csys =  0.12 CPU\)\n` +
+		`Result: PASS\n$`
+	if ok, _ := regexp.MatchString(re, buf.String()); !ok {
+		t.Errorf("incorrect output\n%s", buf.String())
+	}
+}
+
+func TestConsole_fail(t *testing.T) {
+	var buf bytes.Buffer
+	cf := &formatter.ConsoleFormatter{}
+	cf.SetOutput(&buf)
+
+	passed := &test.Test{
+		Path: "t/01.t",
+		Suite: &pet.Testsuite{
+			Ok:    true,
+			Plan:  1,
+			Tests: []*pet.Testline{{Ok: true, Num: 1}},
+		},
+	}
+	failed := &test.Test{
+		Path: "t/02.t",
+		Suite: &pet.Testsuite{
+			Ok:   false,
+			Plan: 5,
+			Tests: []*pet.Testline{
+				{Ok: false, Num: 1},
+				{Ok: false, Num: 2},
+				{Ok: true, Num: 3, Directive: pet.Testline_TODO},
+				{Ok: false, Num: 4, Directive: pet.Testline_TODO},
+			},
+		},
+		Stderr: []byte("#   Failed test at t/02.t line 3.\n"),
+	}
+	cf.Progress(failed, 1, 2)
+	cf.Progress(passed, 2, 2)
+	cf.OpenTest(failed)
+	cf.OpenTest(passed)
+	cf.Report()
+
+	want := "[1/2] t/02.t .. Failed 2/4 subtests\n" +
+		"  STDERR:\n" +
+		"    #   Failed test at t/02.t line 3.\n" +
+		"[2/2] t/01.t .. ok\n" +
+		"\n" +
+		"Test Summary Report\n" +
+		"-------------------\n" +
+		"t/02.t (Tests: 4 Failed: 2)\n" +
+		"  Failed tests:  1-2\n" +
+		"  TODO passed:   3\n" +
+		"  Parse errors: Bad plan.  You planned 5 tests but ran 4.\n" +
+		"Files=2, Tests=5,  0 wallclock secs ( 0.00 cusr  0.00 csys =  0.00 CPU)\n" +
+		"Result: FAIL\n"
+	if buf.String() != want {
+		t.Errorf("want\n%s\ngot\n%s", want, buf.String())
+	}
+}
+
+func TestConsole_timeout(t *testing.T) {
+	var buf bytes.Buffer
+	cf := &formatter.ConsoleFormatter{}
+	cf.SetOutput(&buf)
+
+	passed := &test.Test{
+		Path: "t/01.t",
+		Suite: &pet.Testsuite{
+			Ok:    true,
+			Plan:  1,
+			Tests: []*pet.Testline{{Ok: true, Num: 1}},
+		},
+	}
+	cf.OpenTest(passed)
+	cf.SetResult(&formatter.RunResult{
+		ExitCode:    1,
+		Results:     []*test.Test{passed},
+		NotFinished: []string{"t/03.t", "t/02.t"},
+		Files:       1,
+		Tests:       1,
+	})
+	cf.Report()
+
+	want := "\n" +
+		"Test Summary Report\n" +
+		"-------------------\n" +
+		"t/02.t (Not finished)\n" +
+		"  Test did not finish, e.g. the run timed out or was aborted\n" +
+		"t/03.t (Not finished)\n" +
+		"  Test did not finish, e.g. the run timed out or was aborted\n" +
+		"Files=1, Tests=1,  0 wallclock secs ( 0.00 cusr  0.00 csys =  0.00 CPU)\n" +
+		"Result: FAIL\n"
+	if buf.String() != want {
+		t.Errorf("want\n%s\ngot\n%s", want, buf.String())
+	}
+
+	// a run which timed out before any test file was given out
+	buf.Reset()
+	cf = &formatter.ConsoleFormatter{}
+	cf.SetOutput(&buf)
+	cf.SetResult(&formatter.RunResult{ExitCode: 1})
+	cf.Report()
+	if re := `(?s)Test Summary Report.*Files=0, Tests=0.*Result: FAIL\n$`; !regexp.MustCompile(re).MatchString(buf.String()) {
+		t.Errorf("want the run to fail\ngot\n%s", buf.String())
+	}
+}
@@ -0,0 +1,15 @@
+package formatter
+
+import (
+	"io"
+	"os"
+)
+
+// outputOf returns where a formatter prints, which is the standard output
+// unless SetOutput was called.
+func outputOf(w io.Writer) io.Writer {
+	if w == nil {
+		return os.Stdout
+	}
+	return w
+}
@@ -0,0 +1,265 @@
+package formatter
+
+import (
+	"html/template"
+	"io"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/mix3/eupho/test"
+	pet "gopkg.in/mix3/pet.v3"
+)
+
+// HTMLFormatter renders the results as a single static HTML page.
+type HTMLFormatter struct {
+	// Start is when the run started.
+	Start time.Time
+
+	Tests []*test.Test
+
+	// Result is the whole result of the run, given by SetResult.
+	Result *RunResult
+
+	out io.Writer
+}
+
+type htmlReport struct {
+	Ok          bool
+	Start       time.Time
+	Wallclock   float64
+	Files       int
+	Passed      int
+	Failed      int
+	NotFinished int
+	Tests       int
+	Results     []*htmlResult
+	Slaves      []*htmlSlave
+}
+
+type htmlResult struct {
+	*JSONResult
+	Failed      int
+	Todo        int
+	Skip        int
+	NotFinished bool
+}
+
+type htmlSlave struct {
+	Name string
+	Bars []*htmlBar
+}
+
+// htmlBar is a test file in the timeline, positioned in percent of the run.
+type htmlBar struct {
+	Path  string
+	Ok    bool
+	Left  float64
+	Width float64
+}
+
+func (f *HTMLFormatter) SetOutput(w io.Writer) {
+	f.out = w
+}
+
+func (f *HTMLFormatter) OpenTest(test *test.Test) {
+	f.Tests = append(f.Tests, test)
+}
+
+func (f *HTMLFormatter) SetResult(res *RunResult) {
+	f.Result = res
+}
+
+func (f *HTMLFormatter) Report() {
+	report := f.report(time.Now())
+	if err := htmlTemplate.Execute(outputOf(f.out), report); err != nil {
+		log.Printf("failed to render html: %v", err)
+	}
+}
+
+func (f *HTMLFormatter) report(end time.Time) *htmlReport {
+	start := f.Start
+	for _, t := range f.Tests {
+		if !t.StartTime.IsZero() && (start.IsZero() || t.StartTime.Before(start)) {
+			start = t.StartTime
+		}
+	}
+	if start.IsZero() {
+		start = end
+	}
+	span := end.Sub(start)
+
+	report := &htmlReport{
+		Ok:        true,
+		Start:     start,
+		Wallclock: span.Seconds(),
+		Files:     len(f.Tests),
+	}
+	slaves := map[string]*htmlSlave{}
+	for _, t := range f.Tests {
+		r := &htmlResult{JSONResult: NewJSONResult(t)}
+		for _, line := range t.Suite.Tests {
+			switch {
+			case line.Directive == pet.Testline_TODO:
+				r.Todo++
+			case line.Directive == pet.Testline_SKIP:
+				r.Skip++
+			case !line.Ok:
+				r.Failed++
+			}
+		}
+		report.Results = append(report.Results, r)
+		report.Tests += len(t.Suite.Tests)
+		if t.Suite.Ok {
+			report.Passed++
+		} else {
+			report.Ok = false
+			report.Failed++
+		}
+
+		if t.StartTime.IsZero() || span <= 0 {
+			continue
+		}
+		name := t.Slave
+		if name == "" {
+			name = "unknown"
+		}
+		s, ok := slaves[name]
+		if !ok {
+			s = &htmlSlave{Name: name}
+			slaves[name] = s
+			report.Slaves = append(report.Slaves, s)
+		}
+		s.Bars = append(s.Bars, &htmlBar{
+			Path:  t.Path,
+			Ok:    t.Suite.Ok,
+			Left:  100 * float64(t.StartTime.Sub(start)) / float64(span),
+			Width: 100 * float64(t.EndTime.Sub(t.StartTime)) / float64(span),
+		})
+	}
+	if res := f.Result; res != nil {
+		for _, path := range res.NotFinished {
+			report.Results = append(report.Results, &htmlResult{
+				JSONResult:  &JSONResult{Path: path},
+				NotFinished: true,
+			})
+			report.NotFinished++
+		}
+		if !res.Ok() || res.ExitCode != 0 {
+			report.Ok = false
+		}
+	}
+	sort.Slice(report.Results, func(i, j int) bool {
+		return report.Results[i].Path < report.Results[j].Path
+	})
+	sort.Slice(report.Slaves, func(i, j int) bool {
+		return report.Slaves[i].Name < report.Slaves[j].Name
+	})
+	return report
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>eupho: {{if .Ok}}PASS{{else}}FAIL{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h1.pass { color: #2a7d2a; }
+h1.fail { color: #b52a2a; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { cursor: pointer; background: #f4f4f4; }
+tr.fail > td:first-child { border-left: 4px solid #b52a2a; }
+tr.pass > td:first-child { border-left: 4px solid #2a7d2a; }
+tr.not-finished > td:first-child { border-left: 4px solid #777; }
+.badge { display: inline-block; padding: 0 4px; border-radius: 3px; font-size: 80%; color: #fff; }
+.badge.todo { background: #8a6d3b; }
+.badge.skip { background: #777; }
+.badge.flaky { background: #c77c02; }
+ul.lines { list-style: none; padding-left: 0; font-family: monospace; }
+li.not-ok { color: #b52a2a; }
+pre { background: #f8f8f8; margin: 2px 0 6px 2em; padding: 4px; }
+.timeline { position: relative; height: 18px; background: #f4f4f4; margin: 2px 0; }
+.bar { position: absolute; top: 0; height: 18px; min-width: 2px; }
+.bar.pass { background: #7cbf7c; }
+.bar.fail { background: #e07c7c; }
+</style>
+</head>
+<body>
+<h1 class="{{if .Ok}}pass{{else}}fail{{end}}">Result: {{if .Ok}}PASS{{else}}FAIL{{end}}</h1>
+<p>
+Started at {{.Start.Format "2006-01-02 15:04:05 MST"}},
+{{printf "%.2f" .Wallclock}} wallclock secs.
+Files={{.Files}} (passed {{.Passed}}, failed {{.Failed}}{{if .NotFinished}}, not finished {{.NotFinished}}{{end}}), Tests={{.Tests}}
+</p>
+
+<h2>Test files</h2>
+<table id="results">
+<thead>
+<tr>
+<th data-key="path">Path</th>
+<th data-key="status">Status</th>
+<th data-key="time">Duration</th>
+<th data-key="slave">Slave</th>
+</tr>
+</thead>
+<tbody>
+{{range .Results}}<tr class="{{if .NotFinished}}not-finished{{else if .Ok}}pass{{else}}fail{{end}}" data-path="{{.Path}}" data-status="{{if .NotFinished}}-1{{else if .Ok}}1{{else}}0{{end}}" data-time="{{.Time}}" data-slave="{{.Slave}}">
+<td>
+<details>
+<summary>{{.Path}}</summary>
+<ul class="lines">
+{{range .Tests}}<li class="{{if .Ok}}ok{{else}}not-ok{{end}}">{{if .Ok}}ok{{else}}not ok{{end}} {{.Num}} {{.Description}}
+{{if eq .Directive "TODO"}}<span class="badge todo">TODO</span>{{end}}{{if eq .Directive "SKIP"}}<span class="badge skip">SKIP</span>{{end}} {{.Explanation}}
+{{if .Diagnostic}}<pre>{{.Diagnostic}}</pre>{{end}}</li>
+{{end}}</ul>
+</details>
+</td>
+<td>
+{{if .NotFinished}}Not finished{{else if .Ok}}ok{{else}}Failed {{.Failed}}/{{len .Tests}}{{end}}
+{{if .Todo}}<span class="badge todo">TODO {{.Todo}}</span>{{end}}
+{{if .Skip}}<span class="badge skip">SKIP {{.Skip}}</span>{{end}}
+{{if .Flaky}}<span class="badge flaky">flaky, {{.Attempts}} attempts</span>{{end}}
+</td>
+<td>{{printf "%.3f" .Time}}s</td>
+<td>{{.Slave}}</td>
+</tr>
+{{end}}</tbody>
+</table>
+
+{{if .Slaves}}<h2>Timeline</h2>
+{{range .Slaves}}<div>{{.Name}}</div>
+<div class="timeline">
+{{range .Bars}}<div class="bar {{if .Ok}}pass{{else}}fail{{end}}" title="{{.Path}}" style="left: {{printf "%.2f" .Left}}%; width: {{printf "%.2f" .Width}}%"></div>
+{{end}}</div>
+{{end}}{{end}}
+
+<script>
+(function() {
+	var table = document.getElementById("results");
+	var tbody = table.tBodies[0];
+	var headers = table.tHead.rows[0].cells;
+	for (var i = 0; i < headers.length; i++) {
+		headers[i].addEventListener("click", function() {
+			var key = this.getAttribute("data-key");
+			var desc = this.getAttribute("data-desc") !== "1";
+			this.setAttribute("data-desc", desc ? "1" : "0");
+			var rows = Array.prototype.slice.call(tbody.rows);
+			rows.sort(function(a, b) {
+				var x = a.getAttribute("data-" + key), y = b.getAttribute("data-" + key);
+				if (key === "time" || key === "status") {
+					x = parseFloat(x);
+					y = parseFloat(y);
+				}
+				var c = x < y ? -1 : x > y ? 1 : 0;
+				return desc ? -c : c;
+			});
+			rows.forEach(function(row) { tbody.appendChild(row); });
+		});
+	}
+})();
+</script>
+</body>
+</html>
+`))
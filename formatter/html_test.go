@@ -0,0 +1,75 @@
+package formatter_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mix3/eupho/formatter"
+	"github.com/mix3/eupho/test"
+	pet "gopkg.in/mix3/pet.v3"
+)
+
+func TestHTML(t *testing.T) {
+	var buf bytes.Buffer
+	start := time.Now().Add(-2 * time.Second)
+	hf := &formatter.HTMLFormatter{Start: start}
+	hf.SetOutput(&buf)
+
+	hf.OpenTest(&test.Test{
+		Path: "t/01.t",
+		Suite: &pet.Testsuite{
+			Ok:   false,
+			Plan: 2,
+			Tests: []*pet.Testline{
+				{Ok: false, Num: 1, Description: "compare", Diagnostic: "#   got: '<a>'"},
+				{Ok: false, Num: 2, Directive: pet.Testline_TODO, Explanation: "later"},
+			},
+		},
+		Slave:     "host-1",
+		StartTime: start,
+		EndTime:   start.Add(time.Second),
+	})
+	hf.Report()
+
+	out := buf.String()
+	for _, want := range []string{
+		"Result: FAIL",
+		"<summary>t/01.t</summary>",
+		"#   got: &#39;&lt;a&gt;&#39;",
+		`<span class="badge todo">TODO</span>`,
+		"Failed 1/2",
+		`title="t/01.t" style="left: 0.00%; width: 50.`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("want %q in\n%s", want, out)
+		}
+	}
+}
+
+func TestHTML_notFinished(t *testing.T) {
+	var buf bytes.Buffer
+	hf := &formatter.HTMLFormatter{}
+	hf.SetOutput(&buf)
+
+	passed := &test.Test{
+		Path:  "t/01.t",
+		Suite: &pet.Testsuite{Ok: true, Plan: 1, Tests: []*pet.Testline{{Ok: true, Num: 1}}},
+	}
+	hf.OpenTest(passed)
+	hf.SetResult(&formatter.RunResult{ExitCode: 1, Results: []*test.Test{passed}, NotFinished: []string{"t/02.t"}})
+	hf.Report()
+
+	out := buf.String()
+	for _, want := range []string{
+		"Result: FAIL",
+		"failed 0, not finished 1",
+		`<tr class="not-finished" data-path="t/02.t" data-status="-1"`,
+		"Not finished",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("want %q in\n%s", want, out)
+		}
+	}
+}
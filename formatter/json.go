@@ -0,0 +1,191 @@
+package formatter
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/golang/protobuf/ptypes"
+	durpb "github.com/golang/protobuf/ptypes/duration"
+	"github.com/mix3/eupho/test"
+	pet "gopkg.in/mix3/pet.v3"
+)
+
+// JSONFormatter prints the results of all test files as one JSON document.
+type JSONFormatter struct {
+	Results []*JSONResult
+	Result  *RunResult
+
+	out io.Writer
+}
+
+// JSONReport is the document printed by JSONFormatter. The summary is only
+// printed when the whole result of the run was given by SetResult.
+type JSONReport struct {
+	Ok      bool          `json:"ok"`
+	Summary *JSONSummary  `json:"summary,omitempty"`
+	Results []*JSONResult `json:"results"`
+}
+
+// JSONSummary is the aggregate of a run.
+type JSONSummary struct {
+	RunID       string   `json:"run_id,omitempty"`
+	ExitCode    int      `json:"exit_code"`
+	Files       int      `json:"files"`
+	FailedFiles int      `json:"failed_files"`
+	Tests       int      `json:"tests"`
+	Failures    int      `json:"failures"`
+	Skips       int      `json:"skips"`
+	Todos       int      `json:"todos"`
+	BonusPasses int      `json:"bonus_passes"`
+	NotFinished []string `json:"not_finished"`
+}
+
+// JSONResult is the result of a test file. Durations are in seconds.
+type JSONResult struct {
+	Path       string          `json:"path"`
+	Ok         bool            `json:"ok"`
+	Plan       int32           `json:"plan"`
+	Version    int32           `json:"version"`
+	Time       float64         `json:"time"`
+	UserTime   float64         `json:"user_time"`
+	SystemTime float64         `json:"system_time"`
+	Slave      string          `json:"slave,omitempty"`
+	RunID      string          `json:"run_id,omitempty"`
+	Attempts   int             `json:"attempts"`
+	Flaky      bool            `json:"flaky"`
+	Tests      []*JSONTestline `json:"tests"`
+}
+
+// JSONTestline is a single test line of a test file.
+type JSONTestline struct {
+	Ok          bool    `json:"ok"`
+	Num         int32   `json:"num"`
+	Description string  `json:"description"`
+	Directive   string  `json:"directive,omitempty"`
+	Explanation string  `json:"explanation,omitempty"`
+	Diagnostic  string  `json:"diagnostic,omitempty"`
+	Time        float64 `json:"time"`
+}
+
+func seconds(d *durpb.Duration) float64 {
+	if d == nil {
+		return 0
+	}
+	dur, _ := ptypes.Duration(d)
+	return dur.Seconds()
+}
+
+// NewJSONResult converts the result of a test file for JSON.
+func NewJSONResult(test *test.Test) *JSONResult {
+	suite := test.Suite
+	r := &JSONResult{
+		Path:       test.Path,
+		Ok:         suite.Ok,
+		Plan:       suite.Plan,
+		Version:    suite.Version,
+		Time:       seconds(suite.Time),
+		UserTime:   test.UserTime.Seconds(),
+		SystemTime: test.SystemTime.Seconds(),
+		Slave:      test.Slave,
+		RunID:      test.RunID,
+		Attempts:   test.Attempts,
+		Flaky:      test.Flaky,
+		Tests:      []*JSONTestline{},
+	}
+	for _, line := range suite.Tests {
+		l := &JSONTestline{
+			Ok:          line.Ok,
+			Num:         line.Num,
+			Description: line.Description,
+			Explanation: line.Explanation,
+			Diagnostic:  line.Diagnostic,
+			Time:        seconds(line.Time),
+		}
+		if line.Directive != pet.Testline_NONE {
+			l.Directive = line.Directive.String()
+		}
+		r.Tests = append(r.Tests, l)
+	}
+	return r
+}
+
+func (f *JSONFormatter) SetOutput(w io.Writer) {
+	f.out = w
+}
+
+func (f *JSONFormatter) OpenTest(test *test.Test) {
+	f.Results = append(f.Results, NewJSONResult(test))
+}
+
+func (f *JSONFormatter) SetResult(res *RunResult) {
+	f.Result = res
+}
+
+func (f *JSONFormatter) Report() {
+	report := JSONReport{Ok: true, Results: []*JSONResult{}}
+	for _, r := range f.Results {
+		if !r.Ok {
+			report.Ok = false
+		}
+		report.Results = append(report.Results, r)
+	}
+	if res := f.Result; res != nil {
+		report.Ok = report.Ok && res.Ok()
+		report.Summary = &JSONSummary{
+			RunID:       res.RunID,
+			ExitCode:    res.ExitCode,
+			Files:       res.Files,
+			FailedFiles: res.FailedFiles,
+			Tests:       res.Tests,
+			Failures:    res.Failures,
+			Skips:       res.Skips,
+			Todos:       res.Todos,
+			BonusPasses: res.BonusPasses,
+			NotFinished: append([]string{}, res.NotFinished...),
+		}
+	}
+	sort.Slice(report.Results, func(i, j int) bool {
+		return report.Results[i].Path < report.Results[j].Path
+	})
+
+	enc := json.NewEncoder(outputOf(f.out))
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+}
+
+// NDJSONFormatter prints a JSON line for each test file as soon as its
+// result arrives.
+type NDJSONFormatter struct {
+	printed map[string]bool
+	pending []*test.Test
+
+	out io.Writer
+}
+
+func (f *NDJSONFormatter) SetOutput(w io.Writer) {
+	f.out = w
+}
+
+func (f *NDJSONFormatter) Progress(test *test.Test, done, total int) {
+	if f.printed == nil {
+		f.printed = map[string]bool{}
+	}
+	f.printed[test.Path] = true
+	json.NewEncoder(outputOf(f.out)).Encode(NewJSONResult(test))
+}
+
+func (f *NDJSONFormatter) OpenTest(test *test.Test) {
+	f.pending = append(f.pending, test)
+}
+
+// Report prints the test files whose result never arrived in full, such as
+// those running when the run was aborted.
+func (f *NDJSONFormatter) Report() {
+	enc := json.NewEncoder(outputOf(f.out))
+	for _, t := range f.pending {
+		if !f.printed[t.Path] {
+			enc.Encode(NewJSONResult(t))
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package formatter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mix3/eupho/formatter"
+	"github.com/mix3/eupho/test"
+	pet "gopkg.in/mix3/pet.v3"
+)
+
+func TestJSON(t *testing.T) {
+	var buf bytes.Buffer
+	jf := &formatter.JSONFormatter{}
+	jf.SetOutput(&buf)
+
+	jf.OpenTest(&test.Test{
+		Path: "t/02.t",
+		Suite: &pet.Testsuite{
+			Ok:   false,
+			Plan: 2,
+			Tests: []*pet.Testline{
+				{Ok: false, Num: 1, Description: "first", Diagnostic: "#   Failed test 'first'"},
+				{Ok: true, Num: 2, Directive: pet.Testline_SKIP, Explanation: "no db"},
+			},
+		},
+		Slave:    "host-1",
+		Attempts: 2,
+	})
+	jf.OpenTest(&test.Test{
+		Path:  "t/01.t",
+		Suite: &pet.Testsuite{Ok: true, Plan: 0},
+	})
+	jf.Report()
+
+	var report formatter.JSONReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Ok {
+		t.Error("want fail\ngot success")
+	}
+	if len(report.Results) != 2 || report.Results[0].Path != "t/01.t" {
+		t.Fatalf("want results sorted by path\ngot %s", buf.String())
+	}
+	r := report.Results[1]
+	if r.Slave != "host-1" || r.Attempts != 2 || len(r.Tests) != 2 {
+		t.Errorf("incorrect result\n%s", buf.String())
+	}
+	if r.Tests[0].Diagnostic == "" || r.Tests[1].Directive != "SKIP" || r.Tests[1].Explanation != "no db" {
+		t.Errorf("incorrect testlines\n%s", buf.String())
+	}
+}
+
+func TestJSON_result(t *testing.T) {
+	var buf bytes.Buffer
+	jf := &formatter.JSONFormatter{}
+	jf.SetOutput(&buf)
+
+	passed := &test.Test{Path: "t/01.t", Suite: &pet.Testsuite{Ok: true, Plan: 1, Tests: []*pet.Testline{{Ok: true, Num: 1}}}}
+	jf.OpenTest(passed)
+	jf.SetResult(&formatter.RunResult{
+		ExitCode:    1,
+		RunID:       "0123abcd",
+		Results:     []*test.Test{passed},
+		NotFinished: []string{"t/02.t"},
+		Files:       1,
+		Tests:       1,
+	})
+	jf.Report()
+
+	var report formatter.JSONReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Ok {
+		t.Error("want fail for a test file which did not finish\ngot success")
+	}
+	s := report.Summary
+	if s == nil || s.RunID != "0123abcd" || s.ExitCode != 1 || s.Files != 1 || s.Tests != 1 ||
+		len(s.NotFinished) != 1 || s.NotFinished[0] != "t/02.t" {
+		t.Errorf("incorrect summary\n%s", buf.String())
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	nf := &formatter.NDJSONFormatter{}
+	nf.SetOutput(&buf)
+
+	finished := &test.Test{Path: "t/01.t", Suite: &pet.Testsuite{Ok: true}}
+	partial := &test.Test{Path: "t/02.t", Suite: &pet.Testsuite{Ok: false}}
+	nf.Progress(finished, 1, 2)
+	if n := strings.Count(buf.String(), "\n"); n != 1 {
+		t.Fatalf("want a line as soon as the result arrives\ngot %q", buf.String())
+	}
+	nf.OpenTest(finished)
+	nf.OpenTest(partial)
+	nf.Report()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want 2 lines\ngot %q", buf.String())
+	}
+	for i, path := range []string{"t/01.t", "t/02.t"} {
+		var r formatter.JSONResult
+		if err := json.Unmarshal([]byte(lines[i]), &r); err != nil {
+			t.Fatal(err)
+		}
+		if r.Path != path {
+			t.Errorf("want %s\ngot %s", path, r.Path)
+		}
+	}
+}
@@ -4,7 +4,8 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
-	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/golang/protobuf/ptypes"
@@ -14,13 +15,84 @@ import (
 )
 
 type JUnitFormatter struct {
-	Suites JUnitTestSuites
+	Suites  JUnitTestSuites
+	Options JUnitOptions
+	Result  *RunResult
+
+	out io.Writer
+}
+
+// JUnitOptions changes how test files and test lines are named in the
+// report. The zero value keeps the names of the older versions.
+type JUnitOptions struct {
+	// Classname is how a test path becomes the classname: "legacy"
+	// (t_foo_t), "path" (t/foo.t) or "dotted" (t.foo).
+	Classname string
+
+	// Name is how a test line becomes the testcase name: "legacy" (the
+	// description) or "numbered" (#3 description).
+	Name string
+
+	// File adds the test path as the file attribute, Hostname the host of
+	// the slave, Timestamp when the test started and RunID the run_id
+	// property.
+	File      bool
+	Hostname  bool
+	Timestamp bool
+	RunID     bool
+}
+
+// ParseJUnitOptions parses options given as "classname=path,name=numbered,file".
+func ParseJUnitOptions(args string) (JUnitOptions, error) {
+	opts := JUnitOptions{}
+	if args == "" {
+		return opts, nil
+	}
+	for _, arg := range strings.Split(args, ",") {
+		a := strings.SplitN(arg, "=", 2)
+		key, value := a[0], ""
+		if len(a) >= 2 {
+			value = a[1]
+		}
+		switch key {
+		case "classname":
+			switch value {
+			case "legacy", "path", "dotted":
+			default:
+				return opts, fmt.Errorf("unknown classname strategy: %s", value)
+			}
+			opts.Classname = value
+		case "name":
+			switch value {
+			case "legacy", "numbered":
+			default:
+				return opts, fmt.Errorf("unknown name strategy: %s", value)
+			}
+			opts.Name = value
+		case "file":
+			opts.File = true
+		case "hostname":
+			opts.Hostname = true
+		case "timestamp":
+			opts.Timestamp = true
+		case "run_id":
+			opts.RunID = true
+		default:
+			return opts, fmt.Errorf("unknown option: %s", key)
+		}
+	}
+	return opts, nil
 }
 
-// JUnitTestSuites is a collection of JUnit test suites.
+// JUnitTestSuites is a collection of JUnit test suites. The totals are only
+// set when the whole result of the run was given by SetResult.
 type JUnitTestSuites struct {
-	XMLName xml.Name `xml:"testsuites"`
-	Suites  []JUnitTestSuite
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    string           `xml:"tests,attr,omitempty"`
+	Failures string           `xml:"failures,attr,omitempty"`
+	Errors   string           `xml:"errors,attr,omitempty"`
+	Skipped  string           `xml:"skipped,attr,omitempty"`
+	Suites   []JUnitTestSuite `xml:"testsuite"`
 }
 
 // JUnitTestSuite is a single JUnit test suite which may contain many
@@ -33,8 +105,13 @@ type JUnitTestSuite struct {
 	Skipped    int             `xml:"skipped,attr"`
 	Time       string          `xml:"time,attr"`
 	Name       string          `xml:"name,attr"`
+	File       string          `xml:"file,attr,omitempty"`
+	Hostname   string          `xml:"hostname,attr,omitempty"`
+	Timestamp  string          `xml:"timestamp,attr,omitempty"`
 	Properties []JUnitProperty `xml:"properties>property,omitempty"`
-	TestCases  []JUnitTestCase
+	TestCases  []JUnitTestCase `xml:"testcase"`
+	SystemOut  *JUnitSystemOut `xml:"system-out,omitempty"`
+	SystemErr  *JUnitSystemErr `xml:"system-err,omitempty"`
 }
 
 // JUnitTestCase is a single test case with its result.
@@ -43,6 +120,7 @@ type JUnitTestCase struct {
 	Classname   string            `xml:"classname,attr"`
 	Name        string            `xml:"name,attr"`
 	Time        string            `xml:"time,attr"`
+	File        string            `xml:"file,attr,omitempty"`
 	SkipMessage *JUnitSkipMessage `xml:"skipped,omitempty"`
 	Failure     *JUnitFailure     `xml:"failure,omitempty"`
 	SystemOut   *JUnitSystemOut   `xml:"system-out,omitempty"`
@@ -82,27 +160,90 @@ func (f *JUnitFormatter) formatDuration(d *durpb.Duration) string {
 	return fmt.Sprintf("%.3f", dur.Seconds())
 }
 
+func (f *JUnitFormatter) className(path string) string {
+	switch f.Options.Classname {
+	case "path":
+		return path
+	case "dotted":
+		name := strings.TrimSuffix(path, filepath.Ext(path))
+		name = strings.TrimLeft(filepath.ToSlash(name), "/")
+		return strings.Replace(name, "/", ".", -1)
+	}
+	className := strings.Replace(path, "/", "_", -1)
+	return strings.Replace(className, ".", "_", -1)
+}
+
+func (f *JUnitFormatter) testName(line *pet.Testline) string {
+	if f.Options.Name == "numbered" {
+		return strings.TrimSpace(fmt.Sprintf("#%d %s", line.Num, line.Description))
+	}
+	return line.Description
+}
+
 func (f *JUnitFormatter) OpenTest(test *test.Test) {
-	className := strings.Replace(test.Path, "/", "_", -1)
-	className = strings.Replace(className, ".", "_", -1)
+	className := f.className(test.Path)
+	file := ""
+	if f.Options.File {
+		file = test.Path
+	}
 
 	suite := test.Suite
 
 	ts := JUnitTestSuite{
 		Time: f.formatDuration(suite.Time),
 		Name: className,
+		File: file,
+	}
+	if f.Options.Hostname {
+		ts.Hostname = test.Hostname
+	}
+	if f.Options.Timestamp && !test.StartTime.IsZero() {
+		ts.Timestamp = test.StartTime.Format("2006-01-02T15:04:05")
+	}
+	if f.Options.RunID && test.RunID != "" {
+		ts.Properties = append(ts.Properties, JUnitProperty{
+			Name:  "run_id",
+			Value: test.RunID,
+		})
+	}
+	if test.Attempts > 1 {
+		ts.Properties = append(ts.Properties, JUnitProperty{
+			Name:  "attempts",
+			Value: fmt.Sprintf("%d", test.Attempts),
+		})
+	}
+	if test.Flaky {
+		ts.Properties = append(ts.Properties, JUnitProperty{
+			Name:  "flaky",
+			Value: "true",
+		})
 	}
 
 	for _, line := range suite.Tests {
 		testCase := JUnitTestCase{
 			Classname: className,
-			Name:      line.Description,
+			Name:      f.testName(line),
 			Time:      f.formatDuration(line.Time),
+			File:      file,
 			SystemOut: &JUnitSystemOut{
 				Contents: line.GoString(),
 			},
 		}
-		if !line.Ok {
+		switch {
+		case line.Directive == pet.Testline_SKIP:
+			ts.Skipped++
+			testCase.SkipMessage = &JUnitSkipMessage{
+				Message: line.Explanation,
+			}
+		case line.Directive == pet.Testline_TODO:
+			// a failing TODO test is expected to fail, a passing one passes
+			if !line.Ok {
+				ts.Skipped++
+				testCase.SkipMessage = &JUnitSkipMessage{
+					Message: strings.TrimSpace("TODO " + line.Explanation),
+				}
+			}
+		case !line.Ok:
 			ts.Failures++
 			testCase.Failure = &JUnitFailure{
 				Message:  line.ResultString(),
@@ -110,12 +251,6 @@ func (f *JUnitFormatter) OpenTest(test *test.Test) {
 				Contents: line.Diagnostic,
 			}
 		}
-		if line.Directive == pet.Testline_SKIP {
-			ts.Skipped++
-			testCase.SkipMessage = &JUnitSkipMessage{
-				Message: line.Diagnostic,
-			}
-		}
 		ts.Tests++
 		ts.TestCases = append(ts.TestCases, testCase)
 	}
@@ -126,6 +261,7 @@ func (f *JUnitFormatter) OpenTest(test *test.Test) {
 			Classname: className,
 			Name:      "Test died too soon, even before plan.",
 			Time:      "0.000",
+			File:      file,
 			Failure: &JUnitFailure{
 				Message:  "The test suite died before a plan was produced. You need to have a plan.",
 				Type:     "Plan",
@@ -139,6 +275,7 @@ func (f *JUnitFormatter) OpenTest(test *test.Test) {
 			Classname: className,
 			Name:      "Number of runned tests does not match plan.",
 			Time:      "0.000",
+			File:      file,
 			Failure: &JUnitFailure{
 				Message:  "Some test were not executed, The test died prematurely.",
 				Type:     "Plan",
@@ -148,11 +285,69 @@ func (f *JUnitFormatter) OpenTest(test *test.Test) {
 		ts.TestCases = append(ts.TestCases, testCase)
 	}
 
+	if len(test.Stdout) > 0 {
+		ts.SystemOut = &JUnitSystemOut{Contents: string(test.Stdout)}
+	}
+	if len(test.Stderr) > 0 {
+		ts.SystemErr = &JUnitSystemErr{Contents: string(test.Stderr)}
+	}
+
 	f.Suites.Suites = append(f.Suites.Suites, ts)
 }
 
+func (f *JUnitFormatter) SetOutput(w io.Writer) {
+	f.out = w
+}
+
+func (f *JUnitFormatter) SetResult(res *RunResult) {
+	f.Result = res
+}
+
+// notFinished adds an errored testsuite for a test file without any result.
+func (f *JUnitFormatter) notFinished(path string) {
+	className := f.className(path)
+	file := ""
+	if f.Options.File {
+		file = path
+	}
+	f.Suites.Suites = append(f.Suites.Suites, JUnitTestSuite{
+		Errors: 1,
+		Time:   "0.000",
+		Name:   className,
+		File:   file,
+		TestCases: []JUnitTestCase{{
+			Classname: className,
+			Name:      "Test did not finish.",
+			Time:      "0.000",
+			File:      file,
+			Failure: &JUnitFailure{
+				Message:  "No result of the test file arrived before the run ended.",
+				Type:     "NotFinished",
+				Contents: "Not finished",
+			},
+		}},
+	})
+}
+
 func (f *JUnitFormatter) Report() {
-	out := os.Stdout
+	if f.Result != nil {
+		for _, path := range f.Result.NotFinished {
+			f.notFinished(path)
+		}
+		var tests, failures, errors, skipped int
+		for _, ts := range f.Suites.Suites {
+			tests += ts.Tests
+			failures += ts.Failures
+			errors += ts.Errors
+			skipped += ts.Skipped
+		}
+		f.Suites.Tests = strconv.Itoa(tests)
+		f.Suites.Failures = strconv.Itoa(failures)
+		f.Suites.Errors = strconv.Itoa(errors)
+		f.Suites.Skipped = strconv.Itoa(skipped)
+	}
+
+	out := outputOf(f.out)
 	io.WriteString(out, xml.Header)
 	enc := xml.NewEncoder(out)
 	enc.Indent("", "    ")
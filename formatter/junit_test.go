@@ -6,9 +6,11 @@ import (
 	"os"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/mix3/eupho/formatter"
 	"github.com/mix3/eupho/test"
+	pet "gopkg.in/mix3/pet.v3"
 )
 
 func TestJUnit_success(t *testing.T) {
@@ -106,3 +108,97 @@ func TestJUnit_failplan(t *testing.T) {
 		t.Errorf("incorrect output\n%s", string(b))
 	}
 }
+
+func TestJUnit_directives(t *testing.T) {
+	jf := &formatter.JUnitFormatter{}
+	jf.OpenTest(&test.Test{
+		Path: "t/01.t",
+		Suite: &pet.Testsuite{
+			Ok:   true,
+			Plan: 3,
+			Tests: []*pet.Testline{
+				{Ok: true, Num: 1, Directive: pet.Testline_SKIP, Explanation: "no db"},
+				{Ok: false, Num: 2, Directive: pet.Testline_TODO, Explanation: "later"},
+				{Ok: true, Num: 3, Directive: pet.Testline_TODO},
+			},
+		},
+	})
+
+	ts := jf.Suites.Suites[0]
+	if ts.Tests != 3 || ts.Failures != 0 || ts.Skipped != 2 {
+		t.Errorf("want tests=3 failures=0 skipped=2\ngot tests=%d failures=%d skipped=%d", ts.Tests, ts.Failures, ts.Skipped)
+	}
+	if m := ts.TestCases[0].SkipMessage; m == nil || m.Message != "no db" {
+		t.Errorf("want skip message no db\ngot %#v", m)
+	}
+	if m := ts.TestCases[1].SkipMessage; m == nil || m.Message != "TODO later" {
+		t.Errorf("want skip message TODO later\ngot %#v", m)
+	}
+	if ts.TestCases[2].SkipMessage != nil || ts.TestCases[2].Failure != nil {
+		t.Error("want a passing TODO test to pass")
+	}
+}
+
+func TestJUnit_options(t *testing.T) {
+	opts, err := formatter.ParseJUnitOptions("classname=dotted,name=numbered,file,hostname,timestamp,run_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := formatter.ParseJUnitOptions("classname=flat"); err == nil {
+		t.Error("want an error for an unknown classname strategy")
+	}
+
+	start := time.Date(2017, 4, 1, 12, 0, 0, 0, time.Local)
+	jf := &formatter.JUnitFormatter{Options: opts}
+	jf.OpenTest(&test.Test{
+		Path: "t/foo/bar.t",
+		Suite: &pet.Testsuite{
+			Ok:    true,
+			Plan:  2,
+			Tests: []*pet.Testline{{Ok: true, Num: 1, Description: "first"}, {Ok: true, Num: 2}},
+		},
+		Hostname:  "host",
+		StartTime: start,
+		RunID:     "0123abcd",
+	})
+
+	b, _ := xml.Marshal(jf.Suites)
+	re := `(?s)^<testsuites><testsuite tests="2" failures="0" errors="0" skipped="0" time="0.000" name="t.foo.bar" ` +
+		`file="t/foo/bar.t" hostname="host" timestamp="2017-04-01T12:00:00"><properties>` +
+		`<property name="run_id" value="0123abcd"></property></properties>` +
+		`<testcase classname="t.foo.bar" name="#1 first" time="0.000" file="t/foo/bar.t">.*</testcase>` +
+		`<testcase classname="t.foo.bar" name="#2" time="0.000" file="t/foo/bar.t">.*</testcase></testsuite></testsuites>$`
+	ok, err := regexp.Match(re, b)
+	if err != nil {
+		t.Error(err)
+	}
+	if !ok {
+		t.Errorf("incorrect output\n%s", string(b))
+	}
+}
+
+func TestJUnit_result(t *testing.T) {
+	jf := &formatter.JUnitFormatter{Options: formatter.JUnitOptions{File: true}}
+	passed := &test.Test{Path: "t/01.t", Suite: &pet.Testsuite{Ok: true, Plan: 2, Tests: []*pet.Testline{
+		{Ok: true, Num: 1},
+		{Ok: true, Num: 2, Directive: pet.Testline_SKIP},
+	}}}
+	jf.OpenTest(passed)
+	jf.SetResult(&formatter.RunResult{Results: []*test.Test{passed}, NotFinished: []string{"t/02.t"}})
+	jf.SetOutput(ioutil.Discard)
+	jf.Report()
+
+	b, _ := xml.Marshal(jf.Suites)
+	re := `(?s)^<testsuites tests="2" failures="0" errors="1" skipped="1">` +
+		`<testsuite tests="2" .*</testsuite>` +
+		`<testsuite tests="0" failures="0" errors="1" skipped="0" time="0.000" name="t_02_t" file="t/02.t"><properties></properties>` +
+		`<testcase classname="t_02_t" name="Test did not finish." time="0.000" file="t/02.t">` +
+		`<failure message="[^"]+" type="NotFinished">.*</failure></testcase></testsuite></testsuites>$`
+	ok, err := regexp.Match(re, b)
+	if err != nil {
+		t.Error(err)
+	}
+	if !ok {
+		t.Errorf("incorrect output\n%s", string(b))
+	}
+}
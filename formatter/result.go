@@ -0,0 +1,39 @@
+package formatter
+
+import "github.com/mix3/eupho/test"
+
+// RunResult is the outcome of a run.
+type RunResult struct {
+	// ExitCode is what the commands exit with.
+	ExitCode int
+
+	// RunID is the ID the master gave to the run, "" for merged reports.
+	RunID string
+
+	// Results are the test files with a result sorted by path, with the
+	// testsuite, the slave which ran it, when it started and ended and the
+	// number of attempts. A file whose slave died has the test lines
+	// received so far.
+	Results []*test.Test
+
+	// NotFinished are the test files without any result.
+	NotFinished []string
+
+	// Files is the number of Results, and FailedFiles of those which failed.
+	Files       int
+	FailedFiles int
+
+	// Tests is the number of test lines, Failures of those which failed
+	// except TODO tests, Skips of SKIP tests and Todos of TODO tests.
+	// BonusPasses are the TODO tests which passed unexpectedly.
+	Tests       int
+	Failures    int
+	Skips       int
+	Todos       int
+	BonusPasses int
+}
+
+// Ok reports whether every test file passed.
+func (r *RunResult) Ok() bool {
+	return r.FailedFiles == 0 && len(r.NotFinished) == 0
+}
@@ -2,6 +2,7 @@ package formatter
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/mix3/eupho/test"
 	pet "gopkg.in/mix3/pet.v3"
@@ -9,6 +10,12 @@ import (
 
 type TapFormatter struct {
 	Suites []*pet.Testsuite
+
+	out io.Writer
+}
+
+func (f *TapFormatter) SetOutput(w io.Writer) {
+	f.out = w
 }
 
 func (f *TapFormatter) OpenTest(test *test.Test) {
@@ -16,9 +23,10 @@ func (f *TapFormatter) OpenTest(test *test.Test) {
 }
 
 func (f *TapFormatter) Report() {
+	out := outputOf(f.out)
 	for _, s := range f.Suites {
 		for _, t := range s.Tests {
-			fmt.Printf("%#v", t)
+			fmt.Fprintf(out, "%#v", t)
 		}
 	}
 }
@@ -0,0 +1,233 @@
+package formatter
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mix3/eupho/test"
+	pet "gopkg.in/mix3/pet.v3"
+)
+
+// TAPArchiveFormatter writes the TAP stream of each test file to
+// "<path>.tap" together with a meta.yml, like prove --archive. The archive is
+// written to Dir when it is set, otherwise as a tar.gz to the output.
+type TAPArchiveFormatter struct {
+	// Dir is the directory to write the archive to.
+	Dir string
+
+	// Start is when the run started.
+	Start time.Time
+
+	Tests []*test.Test
+
+	out io.Writer
+}
+
+func (f *TAPArchiveFormatter) SetOutput(w io.Writer) {
+	f.out = w
+}
+
+// CheckOutput requires exactly one destination, Dir or a file to write the
+// tar.gz to, which is not mixed with the other formatters on the standard
+// output.
+func (f *TAPArchiveFormatter) CheckOutput(toFile bool) error {
+	switch {
+	case f.Dir != "" && toFile:
+		return fmt.Errorf("give either a directory as tap-archive=dir or a tar.gz file as tap-archive:path, not both")
+	case f.Dir == "" && !toFile:
+		return fmt.Errorf("give a directory as tap-archive=dir or a tar.gz file as tap-archive:path")
+	}
+	return nil
+}
+
+func (f *TAPArchiveFormatter) OpenTest(test *test.Test) {
+	f.Tests = append(f.Tests, test)
+}
+
+func (f *TAPArchiveFormatter) Report() {
+	if err := f.write(time.Now()); err != nil {
+		log.Printf("failed to write tap archive: %v", err)
+	}
+}
+
+func (f *TAPArchiveFormatter) write(stop time.Time) error {
+	tests := make([]*test.Test, len(f.Tests))
+	copy(tests, f.Tests)
+	sort.Slice(tests, func(i, j int) bool { return tests[i].Path < tests[j].Path })
+
+	files := map[string][]byte{}
+	names := []string{}
+	for _, t := range tests {
+		name := archiveName(t.Path) + ".tap"
+		files[name] = tapStreamOf(t)
+		names = append(names, name)
+	}
+	names = append(names, "meta.yml")
+	files["meta.yml"] = f.meta(tests, stop)
+
+	if f.Dir == "" {
+		return writeTarGz(outputOf(f.out), names, files, stop)
+	}
+	for _, name := range names {
+		path := filepath.Join(f.Dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, files[name], 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// meta returns the meta.yml in the format of TAP::Harness::Archive.
+func (f *TAPArchiveFormatter) meta(tests []*test.Test, stop time.Time) []byte {
+	start := f.Start
+	if start.IsZero() {
+		start = stop
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	buf.WriteString("file_attributes:\n")
+	for _, t := range tests {
+		fmt.Fprintf(&buf, "  - description: %s\n", yamlString(t.Path))
+		fmt.Fprintf(&buf, "    start_time: %s\n", epoch(t.StartTime))
+		fmt.Fprintf(&buf, "    end_time: %s\n", epoch(t.EndTime))
+	}
+	buf.WriteString("file_order:\n")
+	for _, t := range tests {
+		fmt.Fprintf(&buf, "  - %s\n", yamlString(archiveName(t.Path)+".tap"))
+	}
+	fmt.Fprintf(&buf, "start_time: %s\n", epoch(start))
+	fmt.Fprintf(&buf, "stop_time: %s\n", epoch(stop))
+	return buf.Bytes()
+}
+
+// tapStreamOf returns the TAP stream of a test file as the script printed it
+// when it was captured in full, otherwise rebuilt by TAPStream. The result
+// added by the harness for a script which did not end well is a comment.
+func tapStreamOf(t *test.Test) []byte {
+	if len(t.Stdout) == 0 || test.IsTruncated(t.Stdout) {
+		return TAPStream(t.Suite)
+	}
+	var buf bytes.Buffer
+	buf.Write(t.Stdout)
+	if line := test.HarnessResult(t.Suite); line != nil {
+		if !bytes.HasSuffix(t.Stdout, []byte("\n")) {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "# %s\n", line.Description)
+	}
+	return buf.Bytes()
+}
+
+// TAPStream renders a testsuite back to a TAP stream with its version, plan,
+// test lines, diagnostics and YAML blocks. The plan always comes first, and
+// the result added by the harness for a script which did not end well is a
+// comment after the test lines the script printed.
+func TAPStream(suite *pet.Testsuite) []byte {
+	lines := suite.Tests
+	plan := suite.Plan
+	harness := test.HarnessResult(suite)
+	if harness != nil {
+		lines = lines[:len(lines)-1]
+		plan--
+	}
+
+	var buf bytes.Buffer
+	if suite.Version > 12 {
+		fmt.Fprintf(&buf, "TAP version %d\n", suite.Version)
+	}
+	// a script which died before printing anything has no plan, not "1..0"
+	if plan > 0 || plan == 0 && (harness == nil || len(lines) > 0) {
+		fmt.Fprintf(&buf, "1..%d\n", plan)
+	}
+	for _, line := range lines {
+		buf.WriteString(line.ResultString())
+		buf.WriteString("\n")
+		if len(line.Yaml) > 0 {
+			buf.WriteString("  ---\n")
+			for _, l := range strings.Split(strings.TrimRight(string(line.Yaml), "\n"), "\n") {
+				buf.WriteString("  " + l + "\n")
+			}
+			buf.WriteString("  ...\n")
+		}
+		if line.Diagnostic != "" {
+			for _, l := range strings.Split(strings.TrimRight(line.Diagnostic, "\n"), "\n") {
+				if !strings.HasPrefix(l, "#") {
+					l = "# " + l
+				}
+				buf.WriteString(l + "\n")
+			}
+		}
+	}
+	if harness != nil {
+		fmt.Fprintf(&buf, "# %s\n", harness.Description)
+		for _, l := range strings.Split(strings.TrimRight(harness.Diagnostic, "\n"), "\n") {
+			if l != "" {
+				buf.WriteString("# " + l + "\n")
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+func writeTarGz(w io.Writer, names []string, files map[string][]byte, mtime time.Time) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, name := range names {
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(files[name])),
+			ModTime: mtime,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// archiveName makes a test path relative, so that it stays in the archive.
+func archiveName(path string) string {
+	name := filepath.ToSlash(filepath.Clean(path))
+	for {
+		switch {
+		case strings.HasPrefix(name, "/"):
+			name = name[1:]
+		case strings.HasPrefix(name, "../"):
+			name = name[3:]
+		default:
+			return name
+		}
+	}
+}
+
+func epoch(t time.Time) string {
+	if t.IsZero() {
+		return "~"
+	}
+	return fmt.Sprintf("%.6f", float64(t.UnixNano())/1e9)
+}
+
+func yamlString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,165 @@
+package formatter_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mix3/eupho/formatter"
+	"github.com/mix3/eupho/test"
+	pet "gopkg.in/mix3/pet.v3"
+)
+
+func archiveTest() *test.Test {
+	now := time.Now()
+	return &test.Test{
+		Path: "t/01.t",
+		Suite: &pet.Testsuite{
+			Ok:      false,
+			Plan:    3,
+			Version: 13,
+			Tests: []*pet.Testline{
+				{Ok: true, Num: 1, Description: "first"},
+				{Ok: false, Num: 2, Description: "second", Diagnostic: "#   Failed test 'second'", Yaml: []byte("got: 1\nexpected: 2\n")},
+				{Ok: true, Num: 3, Directive: pet.Testline_SKIP, Explanation: "no db"},
+			},
+		},
+		StartTime: now.Add(-time.Second),
+		EndTime:   now,
+	}
+}
+
+const archiveTAP = "TAP version 13\n" +
+	"1..3\n" +
+	"ok 1 - first\n" +
+	"not ok 2 - second\n" +
+	"  ---\n" +
+	"  got: 1\n" +
+	"  expected: 2\n" +
+	"  ...\n" +
+	"#   Failed test 'second'\n" +
+	"ok 3 # SKIP no db\n"
+
+func TestTAPArchive_dir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	af := &formatter.TAPArchiveFormatter{Dir: dir, Start: time.Now()}
+	af.OpenTest(archiveTest())
+	af.Report()
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "t", "01.t.tap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != archiveTAP {
+		t.Errorf("want\n%s\ngot\n%s", archiveTAP, b)
+	}
+
+	meta, err := ioutil.ReadFile(filepath.Join(dir, "meta.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"  - description: 't/01.t'\n", "file_order:\n  - 't/01.t.tap'\n", "start_time: ", "stop_time: "} {
+		if !strings.Contains(string(meta), want) {
+			t.Errorf("want %q in meta.yml\ngot\n%s", want, meta)
+		}
+	}
+}
+
+func TestTAPArchive_tarGz(t *testing.T) {
+	var buf bytes.Buffer
+	af := &formatter.TAPArchiveFormatter{}
+	af.SetOutput(&buf)
+	af.OpenTest(archiveTest())
+	af.Report()
+
+	gr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	names := []string{}
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+		if hdr.Name == "t/01.t.tap" {
+			b, _ := ioutil.ReadAll(tr)
+			if string(b) != archiveTAP {
+				t.Errorf("want\n%s\ngot\n%s", archiveTAP, b)
+			}
+		}
+	}
+	if strings.Join(names, ",") != "t/01.t.tap,meta.yml" {
+		t.Errorf("want t/01.t.tap,meta.yml\ngot %v", names)
+	}
+}
+
+func TestTAPArchive_stdout(t *testing.T) {
+	// the plan at the end and the comments stay as the script printed them
+	stdout := "ok 1 - first\n# a note\nok 2\n1..2\n"
+	tt := &test.Test{
+		Path: "t/01.t",
+		Suite: &pet.Testsuite{
+			Ok:   false,
+			Plan: 3,
+			Tests: []*pet.Testline{
+				{Ok: true, Num: 1, Description: "first"},
+				{Ok: true, Num: 2},
+				{Ok: false, Num: 3, Description: "Test died with return code 255"},
+			},
+		},
+		Stdout: []byte(stdout),
+	}
+	want := stdout + "# Test died with return code 255\n"
+	if b := archived(t, tt); b != want {
+		t.Errorf("want\n%s\ngot\n%s", want, b)
+	}
+
+	// a truncated output is rebuilt from the testsuite
+	tt.Stdout = []byte("ok 1 - first\n\n[truncated at 13 bytes]\n")
+	want = "1..2\nok 1 - first\nok 2\n# Test died with return code 255\n"
+	if b := archived(t, tt); b != want {
+		t.Errorf("want\n%s\ngot\n%s", want, b)
+	}
+
+	// a script which timed out before printing anything
+	tt.Stdout = nil
+	tt.Suite = &pet.Testsuite{Ok: false, Plan: 0, Tests: []*pet.Testline{
+		{Ok: false, Num: 0, Description: "Test timed out after 1s"},
+	}}
+	want = "# Test timed out after 1s\n"
+	if b := archived(t, tt); b != want {
+		t.Errorf("want\n%s\ngot\n%s", want, b)
+	}
+}
+
+// archived returns the TAP stream of tt in a tap archive.
+func archived(t *testing.T, tt *test.Test) string {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	af := &formatter.TAPArchiveFormatter{Dir: dir}
+	af.OpenTest(tt)
+	af.Report()
+	b, err := ioutil.ReadFile(filepath.Join(dir, "t", "01.t.tap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
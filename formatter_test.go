@@ -0,0 +1,111 @@
+package eupho
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mix3/eupho/formatter"
+	"github.com/mix3/eupho/test"
+	pet "gopkg.in/mix3/pet.v3"
+)
+
+func TestOpenFormatters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "out", "junit.xml")
+	f, closers, err := openFormatters([]string{"junit:" + path, "console"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf, ok := f.(multiFormatter)
+	if !ok || len(mf) != 2 {
+		t.Fatalf("want 2 formatters\ngot %#v", f)
+	}
+	var buf bytes.Buffer
+	mf[1].SetOutput(&buf)
+
+	tt := &test.Test{Path: "t/01.t", Suite: &pet.Testsuite{Ok: true, Plan: 1, Tests: []*pet.Testline{{Ok: true, Num: 1}}}}
+	f.(ProgressFormatter).Progress(tt, 1, 1)
+	f.OpenTest(tt)
+	f.Report()
+	closeAll(closers)
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "<testsuites>") {
+		t.Errorf("want junit report in %s\ngot %s", path, b)
+	}
+	if !strings.Contains(buf.String(), "[1/1] t/01.t .. ok") || !strings.Contains(buf.String(), "Result: PASS") {
+		t.Errorf("want console report\ngot %s", buf.String())
+	}
+
+	if _, _, err := openFormatters([]string{"junti"}); err == nil {
+		t.Error("want an error for an unknown formatter")
+	}
+
+	// tap-archive needs either a directory or a file, but not both
+	for _, tc := range []struct {
+		spec    string
+		wantErr bool
+	}{
+		{"tap-archive", true},
+		{"tap-archive=" + filepath.Join(dir, "archive") + ":" + filepath.Join(dir, "archive.tar.gz"), true},
+		{"tap-archive=" + filepath.Join(dir, "archive"), false},
+		{"tap-archive:" + filepath.Join(dir, "archive.tar.gz"), false},
+	} {
+		_, closers, err := openFormatters([]string{tc.spec})
+		closeAll(closers)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: want error %v\ngot %v", tc.spec, tc.wantErr, err)
+		}
+	}
+}
+
+func TestAppendFormatterLoader(t *testing.T) {
+	var loaded string
+	AppendFormatterLoader("custom", FormatterLoaderFunc(func(name, args string) (Formatter, error) {
+		loaded = name + " " + args
+		return &formatter.TapFormatter{}, nil
+	}))
+	defer delete(formatterLoaders, "custom")
+
+	if _, _, err := openFormatters([]string{"custom=a,b"}); err != nil {
+		t.Fatal(err)
+	}
+	if loaded != "custom a,b" {
+		t.Errorf("want custom a,b\ngot %s", loaded)
+	}
+}
+
+func TestParseFormatterSpec(t *testing.T) {
+	for _, tc := range []struct {
+		spec, name, args, path string
+	}{
+		{"console", "console", "", ""},
+		{"junit=x=1:out/junit.xml", "junit", "x=1", "out/junit.xml"},
+		{"json:out/eupho.json", "json", "", "out/eupho.json"},
+		{`json:C:\out\eupho.json`, "json", "", `C:\out\eupho.json`},
+		{`junit=file:C:\out\junit.xml`, "junit", "file", `C:\out\junit.xml`},
+		{`junit=hostname=h\:8080`, "junit", "hostname=h:8080", ""},
+		{`junit=hostname=h\:8080:out/junit.xml`, "junit", "hostname=h:8080", "out/junit.xml"},
+		{`tap-archive=C\:\archive`, "tap-archive", `C:\archive`, ""},
+		{`tap-archive=dir\x`, "tap-archive", `dir\x`, ""},
+		{"json=", "json", "", ""},
+		{"json:", "json", "", ""},
+	} {
+		name, args, path := parseFormatterSpec(tc.spec)
+		if name != tc.name || args != tc.args || path != tc.path {
+			t.Errorf("%s: want %q, %q, %q\ngot %q, %q, %q", tc.spec, tc.name, tc.args, tc.path, name, args, path)
+		}
+	}
+}
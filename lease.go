@@ -0,0 +1,206 @@
+package eupho
+
+import (
+	"log"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/stats"
+)
+
+const leaseCheckInterval = 1 * time.Second
+
+// lease records that a test file has been handed to a slave and until when
+// the master waits for its result before dispatching it again.
+type lease struct {
+	id       int64
+	path     string
+	holder   string
+	start    time.Time
+	deadline time.Time
+}
+
+// heldBy reports whether the lease is the one of holder, identified by its ID
+// when the slave sent one.
+func (l *lease) heldBy(holder string, leaseID int64) bool {
+	if leaseID != 0 {
+		return l.id == leaseID
+	}
+	return l.holder == holder
+}
+
+// nextLease pops a pending test file and leases it to holder. It blocks until
+// a file is available, and returns nil once every file has a result.
+func (m *Master) nextLease(ctx context.Context, holder string) (*lease, error) {
+	for {
+		m.mu.Lock()
+		if m.finished {
+			m.mu.Unlock()
+			return nil, nil
+		}
+		if len(m.pending) > 0 {
+			path := m.popPending(holder)
+			m.attempts[path]++
+			m.leaseSeq++
+			now := time.Now()
+			l := &lease{
+				id:       m.leaseSeq,
+				path:     path,
+				holder:   holder,
+				start:    now,
+				deadline: now.Add(m.opts.LeaseTimeout),
+			}
+			m.leases[path] = l
+			m.mu.Unlock()
+			return l, nil
+		}
+		wakeCh := m.wakeCh
+		m.mu.Unlock()
+
+		select {
+		case <-wakeCh:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// resultReceived reports whether the result of a lease was already
+// processed, such as a result sent again after its stream failed to close,
+// and records it otherwise. Slaves older than lease IDs send 0.
+func (m *Master) resultReceived(leaseID int64) bool {
+	if leaseID == 0 {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.received[leaseID] {
+		return true
+	}
+	m.received[leaseID] = true
+	return false
+}
+
+// popPending removes the next test file to run on holder from the pending
+// files, preferring one that did not fail on holder last time.
+// m.mu must be held.
+func (m *Master) popPending(holder string) string {
+	i := 0
+	for j, path := range m.pending {
+		if m.avoid[path] != holder {
+			i = j
+			break
+		}
+	}
+	path := m.pending[i]
+	m.pending = append(m.pending[:i], m.pending[i+1:]...)
+	return path
+}
+
+// wake notifies every GetTest waiting in nextLease. m.mu must be held.
+func (m *Master) wake() {
+	close(m.wakeCh)
+	m.wakeCh = make(chan struct{})
+}
+
+// requeue puts path back in front of the pending files. m.mu must be held.
+func (m *Master) requeue(path string) {
+	delete(m.leases, path)
+	if m.testResult[path] != nil {
+		return
+	}
+	m.pending = append([]string{path}, m.pending...)
+	m.wake()
+}
+
+// removePending drops path from the pending files when its result arrives
+// after the lease has already expired. m.mu must be held.
+func (m *Master) removePending(path string) {
+	for i, p := range m.pending {
+		if p == path {
+			m.pending = append(m.pending[:i], m.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// releaseLeases re-dispatches every test file leased to holder.
+func (m *Master) releaseLeases(holder, reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for path, l := range m.leases {
+		if l.holder != holder {
+			continue
+		}
+		log.Printf("requeue: %s (%s %s)", path, m.describe(holder), reason)
+		m.requeue(path)
+	}
+}
+
+// expireLeases re-dispatches every test file whose lease deadline passed.
+func (m *Master) expireLeases(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for path, l := range m.leases {
+		if now.Before(l.deadline) {
+			continue
+		}
+		log.Printf("requeue: %s (lease of %s expired)", path, m.describe(l.holder))
+		m.requeue(path)
+	}
+}
+
+// watchLeases expires the leases and the slaves until the run finished or
+// stopServe was called.
+func (m *Master) watchLeases() {
+	defer close(m.watched)
+	ticker := time.NewTicker(leaseCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		var now time.Time
+		select {
+		case now = <-ticker.C:
+		case <-m.stopCh:
+			return
+		}
+		m.mu.Lock()
+		finished := m.finished
+		m.mu.Unlock()
+		if finished {
+			return
+		}
+		m.expireSlaves(now)
+		m.expireLeases(now)
+	}
+}
+
+type connAddrKey struct{}
+
+// connHandler re-dispatches the leases of a slave as soon as its connection
+// to the master is closed.
+type connHandler struct {
+	m *Master
+}
+
+func (h *connHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *connHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {}
+
+func (h *connHandler) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	return context.WithValue(ctx, connAddrKey{}, info.RemoteAddr.String())
+}
+
+func (h *connHandler) HandleConn(ctx context.Context, s stats.ConnStats) {
+	if _, ok := s.(*stats.ConnEnd); !ok {
+		return
+	}
+	if addr, ok := ctx.Value(connAddrKey{}).(string); ok {
+		h.m.disconnectSlaves(addr)
+		h.m.releaseLeases(addr, "disconnected")
+	}
+}
@@ -1,20 +1,23 @@
 package eupho
 
 import (
+	"crypto/tls"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"runtime"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/golang/protobuf/ptypes"
+	durpb "github.com/golang/protobuf/ptypes/duration"
 	"github.com/jessevdk/go-flags"
-	"github.com/mix3/eupho/formatter"
 	"github.com/mix3/eupho/test"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/credentials"
 	pet "gopkg.in/mix3/pet.v3"
 )
 
@@ -23,62 +26,177 @@ type Master struct {
 
 	timeouter  *time.Timer
 	testFiles  []string
-	testResult map[string]*pet.Testsuite
-
-	server     *grpc.Server
-	testFileCh chan string
-	endCh      chan error
-	exitCode   int
-	mu         sync.Mutex
-
-	opts masterOptions
-	args []string
+	testResult map[string]*test.Test
+	timings    timings
+	state      *state
+	selectors  []string
+	mtimes     map[string]int64
+	expected   *checkout
+	tlsConfig  *tls.Config
+	token      string
+	runID      string
+
+	partial  map[string]*pet.Testsuite // test lines of running files
+	attempts map[string]int            // number of times each file was dispatched
+	received map[int64]bool            // leases whose result was processed
+	failures map[string]int            // number of failed results of each file
+	avoid    map[string]string         // holder that failed each file last
+
+	server   *grpc.Server
+	stopCh   chan struct{} // closed by stopServe to stop the goroutines of startServe
+	watched  chan struct{} // closed when watchLeases returns
+	pending  []string
+	leases   map[string]*lease
+	slaves   map[string]*slaveInfo
+	slaveSeq int
+	leaseSeq int64
+	wakeCh   chan struct{}
+	finished bool
+	aborted  time.Time
+	endCh    chan error
+	exitCode int
+	mu       sync.Mutex
+
+	opts MasterConfig
 }
 
-type masterOptions struct {
-	Addr      string        `          long:"addr"    default:"127.0.0.1:19300" description:"Listen addr"`
-	Timeout   time.Duration `          long:"timeout" default:"10m"             description:"Timeout duration"`
-	Version   bool          `          long:"version"                           description:"Show version of eupho"`
-	Quiet     bool          `short:"q" long:"quiet"                             description:"quiet"`
-	Formatter string        `          long:"formatter"                         description:"Result formatter to use."`
+// MasterConfig is the configuration of a master. ParseArgs fills it from the
+// command line options.
+type MasterConfig struct {
+	Addr          string        `          long:"addr"            default:"127.0.0.1:19300" description:"Listen addr"`
+	Timeout       time.Duration `          long:"timeout"         default:"10m"             description:"Timeout duration"`
+	LeaseTimeout  time.Duration `          long:"lease-timeout"   default:"5m"              description:"Re-dispatch a test file to another slave when its result does not arrive within this duration"`
+	SlaveTimeout  time.Duration `          long:"slave-timeout"   default:"30s"             description:"Drop a slave when no heartbeat arrives within this duration"`
+	Version       bool          `          long:"version"                                   description:"Show version of eupho"`
+	Quiet         bool          `short:"q" long:"quiet"                                     description:"quiet"`
+	Verbose       bool          `short:"v" long:"verbose"                                   description:"Print the output of test scripts as it arrives"`
+	Formatter     []string      `          long:"formatter"                                 description:"Result formatter to use as name[=args][:path], console by default. Can be given multiple times"`
+	Timings       string        `          long:"timings"                                   description:"File to keep test durations in, used to dispatch the slowest tests first unless --state=slow orders them"`
+	State         []string      `          long:"state"                                     description:"Select test files by the previous runs and save the results: failed, passed, new, slow, fresh, save"`
+	StateFile     string        `          long:"state-file"      default:".eupho-state"    description:"File to keep the state in"`
+	RetryFailed   int           `          long:"retry-failed"    default:"0"               description:"Re-run a failed test file up to N times"`
+	FlakyExitCode int           `          long:"flaky-exit-code" default:"0"               description:"Exit code when some test files passed only on retry"`
+	Discover      bool          `          long:"discover"                                  description:"Find the test files on the master from the arguments instead of taking the list of the first slave"`
+	Verify        bool          `          long:"verify"                                    description:"Reject slaves whose test files or checkout revision differ from the master's, or the first slave's"`
+	Ext           []string      `          long:"ext"             default:".t"              description:"Extension of the test files to --discover in directories. Can be given multiple times"`
+	Include       []string      `          long:"include"                                   description:"Only --discover the test files matching this glob. Can be given multiple times"`
+	Exclude       []string      `          long:"exclude"                                   description:"Skip the test files and directories matching this glob in --discover, like the lines of .euphoignore. Can be given multiple times"`
+	NoRecurse     bool          `          long:"no-recurse"                                description:"Do not --discover test files in subdirectories"`
+	TLSCert       string        `          long:"tls-cert"                                  description:"Serve the slaves over TLS with this certificate file"`
+	TLSKey        string        `          long:"tls-key"                                   description:"Key file of --tls-cert"`
+	TLSCA         string        `          long:"tls-ca"                                    description:"Require the slaves to present a client certificate signed by a CA in this file"`
+	Token         string        `          long:"token"                                     description:"Reject the slaves without this shared secret, EUPHO_TOKEN by default"`
+	TokenFile     string        `          long:"token-file"                                description:"Read --token from this file"`
+	RunID         string        `          long:"run-id"                                    description:"ID of this run to tell its slaves from the others and to put in the reports, random by default"`
+
+	// Args are the files, directories or globs to Discover.
+	Args []string
 }
 
 func NewMaster() *Master {
 	m := &Master{
-		testResult: map[string]*pet.Testsuite{},
-		testFileCh: make(chan string),
-		endCh:      make(chan error),
+		testResult: map[string]*test.Test{},
+		mtimes:     map[string]int64{},
+		leases:     map[string]*lease{},
+		slaves:     map[string]*slaveInfo{},
+		partial:    map[string]*pet.Testsuite{},
+		attempts:   map[string]int{},
+		received:   map[int64]bool{},
+		failures:   map[string]int{},
+		avoid:      map[string]string{},
+		wakeCh:     make(chan struct{}),
+		endCh:      make(chan error, 1),
 		exitCode:   0,
+		runID:      newRunID(),
 	}
 	return m
 }
 
-func (m *Master) ParseArgs(args []string) {
-	var (
-		opts masterOptions
-		err  error
-	)
+// DefaultMasterConfig returns the configuration with the defaults of the
+// command line options.
+func DefaultMasterConfig() MasterConfig {
+	var c MasterConfig
+	flags.NewParser(&c, flags.None).ParseArgs([]string{})
+	return c
+}
+
+// NewMasterWithConfig returns a master configured by c instead of ParseArgs.
+// Addr and the timeouts left zero take the defaults of DefaultMasterConfig.
+func NewMasterWithConfig(c MasterConfig) (*Master, error) {
+	m := NewMaster()
+	if err := m.configure(c); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Master) ParseArgs(args []string) error {
+	var opts MasterConfig
 	parser := flags.NewParser(
 		&opts,
 		flags.HelpFlag|flags.PassDoubleDash,
 	)
-	m.args, err = parser.ParseArgs(args)
+	parser.Usage = "[OPTIONS] [files, directories or globs to --discover]"
+	describeFormatters(parser)
+	rest, err := parser.ParseArgs(args)
+	if err != nil {
+		return err
+	}
+	opts.Args = rest
+
+	return m.configure(opts)
+}
+
+func (m *Master) configure(c MasterConfig) error {
+	def := DefaultMasterConfig()
+	if c.Addr == "" {
+		c.Addr = def.Addr
+	}
+	if err := defaultDuration("timeout", &c.Timeout, def.Timeout); err != nil {
+		return err
+	}
+	if err := defaultDuration("lease-timeout", &c.LeaseTimeout, def.LeaseTimeout); err != nil {
+		return err
+	}
+	if err := defaultDuration("slave-timeout", &c.SlaveTimeout, def.SlaveTimeout); err != nil {
+		return err
+	}
+	if err := checkFormatters(c.Formatter); err != nil {
+		return &ConfigError{Option: "formatter", Err: err}
+	}
+	selectors, err := parseStateSelectors(c.State)
 	if err != nil {
-		fmt.Println(err)
-		if e, ok := err.(*flags.Error); ok && e.Type == flags.ErrHelp {
-			os.Exit(0)
+		return &ConfigError{Option: "state", Err: err}
+	}
+	if c.TLSCert != "" || c.TLSKey != "" || c.TLSCA != "" {
+		m.tlsConfig, err = serverTLSConfig(c.TLSCert, c.TLSKey, c.TLSCA)
+		if err != nil {
+			return &ConfigError{Option: "tls-cert", Err: err}
 		}
-		os.Exit(1)
 	}
 
-	m.opts = opts
+	m.token, err = loadToken(c.Token, c.TokenFile)
+	if err != nil {
+		return &ConfigError{Option: "token-file", Err: err}
+	}
+
+	if c.RunID != "" {
+		m.runID = c.RunID
+	}
+
+	m.selectors = selectors
+	m.opts = c
 
 	m.timeouter = time.NewTimer(m.opts.Timeout)
+	return nil
 }
 
+// Run runs the master from the command line and returns the exit code.
 func (m *Master) Run(args []string) int {
 	if args != nil {
-		m.ParseArgs(args)
+		if err := m.ParseArgs(args); err != nil {
+			return parseFailed(err)
+		}
 	}
 
 	if m.opts.Version {
@@ -86,84 +204,281 @@ func (m *Master) Run(args []string) int {
 		return m.exitCode
 	}
 
-	switch m.opts.Formatter {
-	case "junit":
-		m.Formatter = &formatter.JUnitFormatter{}
-	case "tap", "":
-		m.Formatter = &formatter.TapFormatter{}
-	default:
-		panic(fmt.Sprintf("unknown formatter: %s", m.opts.Formatter))
+	stopSignals := notifySignals(func(sig os.Signal) {
+		m.abort(fmt.Sprintf("received %s", sig))
+	})
+	defer stopSignals()
+
+	res, err := m.RunContext(context.Background())
+	if err != nil && err != ErrAborted {
+		log.Println(err)
+	}
+	if res == nil {
+		return 1
 	}
+	return res.ExitCode
+}
 
-	m.startServe()
+// RunContext serves the slaves until every test file has finished and
+// reports the results. Canceling ctx aborts the run like Abort.
+//
+// When the run was aborted or timed out, the results of the tests finished
+// so far are returned with ErrAborted or ErrTimeout.
+func (m *Master) RunContext(ctx context.Context) (*RunResult, error) {
+	f, closers, err := openFormatters(m.opts.Formatter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open formatters: %v", err)
+	}
+	defer closeAll(closers)
+	m.Formatter = f
+
+	if m.opts.Timings != "" {
+		t, err := loadTimings(m.opts.Timings)
+		if err != nil {
+			log.Printf("failed to load timings: %v", err)
+			t = timings{}
+		}
+		m.timings = t
+	}
+
+	if len(m.selectors) > 0 {
+		st, err := loadState(m.opts.StateFile)
+		if err != nil {
+			log.Printf("failed to load state: %v", err)
+			st = &state{Tests: map[string]*testState{}}
+		}
+		m.state = st
+	}
 
-	if err := <-m.endCh; err != nil {
-		panic(err)
+	if m.opts.Discover {
+		d := &discovery{
+			Exts:      m.opts.Ext,
+			Include:   m.opts.Include,
+			Exclude:   m.opts.Exclude,
+			NoRecurse: m.opts.NoRecurse,
+		}
+		testFiles, err := d.find(m.opts.Args)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("discover: %d test files", len(testFiles))
+		if m.opts.Verify {
+			m.expected = &checkout{
+				TestFilesHash: testFilesHash(testFiles),
+				Revision:      checkoutRevision(),
+				source:        "the master",
+			}
+		}
+		m.initTestFiles(false, testFiles, fileMtimes(testFiles))
+	}
+
+	if err := m.startServe(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			m.abort(ctx.Err().Error())
+		case <-done:
+		}
+	}()
+
+	err = <-m.endCh
+	switch err {
+	case ErrAborted:
+		// keep serving until the slaves have been told to abort
+		m.waitSlavesAborted()
+		m.exitCode = 1
+	case ErrTimeout:
+		// dispatch no more and let the lease watcher stop
+		m.mu.Lock()
+		m.finished = true
+		m.wake()
+		m.mu.Unlock()
+		m.exitCode = 1
 	}
 
 	m.stopServe()
-	m.report()
+	m.reportSlaves()
 
-	return m.exitCode
+	if m.exitCode == 0 && len(m.flakyTests()) > 0 {
+		m.exitCode = m.opts.FlakyExitCode
+	}
+
+	return m.report(), err
 }
 
-func (m *Master) startServe() {
+func (m *Master) startServe() error {
 	l, err := net.Listen("tcp", m.opts.Addr)
 	if err != nil {
-		panic(fmt.Sprintf("failed to listen: %v", err))
+		return fmt.Errorf("failed to listen: %v", err)
+	}
+	opts := []grpc.ServerOption{grpc.StatsHandler(&connHandler{m: m})}
+	if m.tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(m.tlsConfig)))
 	}
-	m.server = grpc.NewServer()
+	if m.token != "" {
+		a := &authenticator{token: m.token}
+		opts = append(opts, grpc.UnaryInterceptor(a.unary), grpc.StreamInterceptor(a.stream))
+	}
+	m.server = grpc.NewServer(opts...)
 	RegisterEuphoServer(m.server, m)
-	log.Println("listen on", m.opts.Addr)
+	if m.tlsConfig != nil {
+		log.Println("listen on", m.opts.Addr, "with TLS")
+	} else {
+		log.Println("listen on", m.opts.Addr)
+	}
+	log.Printf("run: %s", m.runID)
+	m.stopCh = make(chan struct{})
+	m.watched = make(chan struct{})
 	go m.server.Serve(l)
+	go m.watchLeases()
 
 	go func() {
-		<-m.timeouter.C
-		m.endCh <- fmt.Errorf("slave request was lost")
+		select {
+		case <-m.timeouter.C:
+		case <-m.stopCh:
+			return
+		}
+		select {
+		case m.endCh <- ErrTimeout:
+		case <-m.stopCh:
+		}
 	}()
+	return nil
 }
 
 func (m *Master) stopServe() {
 	time.Sleep(1 * time.Second)
 	m.server.Stop()
+	close(m.stopCh)
+	<-m.watched
 }
 
-func (m *Master) report() {
-	for path, suite := range m.testResult {
-		m.Formatter.OpenTest(&test.Test{
-			Path:  path,
-			Suite: suite,
-		})
+// report gives the results to the formatter and records them to the timings
+// and the state.
+func (m *Master) report() *RunResult {
+	res := m.result()
+	for _, t := range res.Results {
+		m.Formatter.OpenTest(t)
+	}
+	for _, path := range res.NotFinished {
+		log.Printf("not finished: %s", path)
+	}
+	if f, ok := m.Formatter.(ResultFormatter); ok {
+		f.SetResult(res)
 	}
 	m.Formatter.Report()
+
+	for _, path := range m.flakyTests() {
+		log.Printf("flaky: %s (passed on attempt %d)", path, m.attempts[path])
+	}
+
+	if m.timings != nil {
+		for path, t := range m.testResult {
+			if t != nil {
+				m.timings.record(path, t.Suite)
+			}
+		}
+		if err := m.timings.save(m.opts.Timings); err != nil {
+			log.Printf("failed to save timings: %v", err)
+		}
+	}
+
+	if m.state != nil && m.stateSelected("save") {
+		now := time.Now()
+		for path, t := range m.testResult {
+			if t != nil {
+				m.state.record(t, m.mtimes[path], now)
+			}
+		}
+		if err := m.state.save(m.opts.StateFile); err != nil {
+			log.Printf("failed to save state: %v", err)
+		}
+	}
+
+	return res
+}
+
+// result returns the result of the run with the test lines received so far
+// for the files whose slave died.
+func (m *Master) result() *RunResult {
+	m.mu.Lock()
+	results := make(map[string]*test.Test, len(m.testResult))
+	for path, t := range m.testResult {
+		results[path] = t
+	}
+	m.mu.Unlock()
+
+	tests, notFinished := []*test.Test{}, []string{}
+	for path, t := range results {
+		if t == nil {
+			if suite := m.partialSuite(path); suite != nil {
+				t = &test.Test{Path: path, Suite: suite, Attempts: m.attempts[path], RunID: m.runID}
+			}
+		}
+		if t == nil {
+			notFinished = append(notFinished, path)
+			continue
+		}
+		tests = append(tests, t)
+	}
+	res := newRunResult(tests, notFinished, m.exitCode)
+	res.RunID = m.runID
+	return res
 }
 
 func (m *Master) GetTest(ctx context.Context, req *GetTestRequest) (*GetTestResponse, error) {
-	m.initTestFiles(req.Submitted, req.TestFiles)
+	if err := m.checkRun(req.RunId, req.SlaveId, "test request from "+peerAddr(ctx)); err != nil {
+		return nil, err
+	}
+	if err := m.checkRegistered(req.SlaveId); err != nil {
+		return nil, err
+	}
+	m.initTestFiles(req.Submitted, req.TestFiles, req.TestFileMtimes)
 
 	m.timeouter.Reset(m.opts.Timeout)
 
-	path := <-m.testFileCh
-	if path != "" {
-		peer, ok := peer.FromContext(ctx)
-		if ok {
-			log.Printf("send: %s -> %v", path, peer.Addr)
-		} else {
-			log.Printf("send: %s -> ???", path)
-		}
+	holder := m.holder(ctx, req.SlaveId)
+	l, err := m.nextLease(ctx, holder)
+	if err != nil {
+		return nil, err
 	}
+	if l == nil {
+		return &GetTestResponse{}, nil
+	}
+	m.mu.Lock()
+	log.Printf("send: %s -> %s", l.path, m.describe(holder))
+	m.mu.Unlock()
 
-	return &GetTestResponse{Path: path}, nil
+	return &GetTestResponse{Path: l.path, LeaseId: l.id}, nil
 }
 
 func (m *Master) Result(ctx context.Context, req *ResultRequest) (*ResultResponse, error) {
-	ts := req.Testsuite
-	peer, ok := peer.FromContext(ctx)
-	if ok {
-		log.Printf("receive: %s <- %v", req.Path, peer.Addr)
-	} else {
-		log.Printf("receive: %s <- ???", req.Path)
+	if err := m.checkRun(req.RunId, req.SlaveId, fmt.Sprintf("result of %s from %s", req.Path, peerAddr(ctx))); err != nil {
+		return nil, err
+	}
+	if m.isAborted() {
+		log.Printf("ignore: %s (run aborted)", req.Path)
+		return &ResultResponse{}, nil
 	}
+	if err := m.checkRegistered(req.SlaveId); err != nil {
+		return nil, err
+	}
+
+	if m.resultReceived(req.LeaseId) {
+		log.Printf("ignore: %s (result of lease %d already received)", req.Path, req.LeaseId)
+		return &ResultResponse{}, nil
+	}
+
+	ts := req.Testsuite
+	holder := m.holder(ctx, req.SlaveId)
+	m.mu.Lock()
+	log.Printf("receive: %s <- %s", req.Path, m.describe(holder))
+	m.mu.Unlock()
 	if !m.opts.Quiet {
 		for _, line := range ts.Tests {
 			if !line.Ok {
@@ -171,26 +486,155 @@ func (m *Master) Result(ctx context.Context, req *ResultRequest) (*ResultRespons
 			}
 		}
 	}
-	m.EndCheck(req.Path, ts)
+	m.endCheck(holder, req.LeaseId, &test.Test{
+		Path:       req.Path,
+		Suite:      ts,
+		UserTime:   durationOf(req.UserTime),
+		SystemTime: durationOf(req.SystemTime),
+		Stdout:     req.Stdout,
+		Stderr:     req.Stderr,
+	})
 	return &ResultResponse{}, nil
 }
 
+// EndCheck records the result of path whoever holds its lease.
 func (m *Master) EndCheck(path string, ts *pet.Testsuite) {
+	m.endCheck("", 0, &test.Test{Path: path, Suite: ts})
+}
+
+// endCheck records the result of a test file sent by holder for the lease
+// leaseID. A result whose lease was given to another slave in the meantime
+// is dropped, that slave's result is awaited instead.
+func (m *Master) endCheck(holder string, leaseID int64, t *test.Test) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.testResult[path] = ts
+
+	path, ts := t.Path, t.Suite
+	if m.testResult[path] != nil {
+		log.Printf("ignore: %s (result already received)", path)
+		return
+	}
+	if l, ok := m.leases[path]; ok {
+		if holder != "" && !l.heldBy(holder, leaseID) {
+			log.Printf("ignore: %s (stale result from %s, leased to %s)", path, m.describe(holder), m.describe(l.holder))
+			return
+		}
+		if holder != "" {
+			t.StartTime = l.start
+		}
+		delete(m.leases, path)
+	}
+	t.EndTime = time.Now()
+	m.removePending(path)
+	delete(m.partial, path)
+	if si, ok := m.slaves[holder]; ok {
+		si.Done++
+		t.Hostname = si.Hostname
+	}
+	if !ts.Ok {
+		m.failures[path]++
+		if m.failures[path] <= m.opts.RetryFailed {
+			log.Printf("retry: %s (failed %d/%d)", path, m.failures[path], m.opts.RetryFailed+1)
+			m.avoid[path] = holder
+			m.pending = append(m.pending, path)
+			m.wake()
+			return
+		}
+	}
+	t.Slave = holder
+	t.Attempts = m.attempts[path]
+	t.RunID = m.runID
+	t.Flaky = ts.Ok && m.failures[path] > 0
+	m.testResult[path] = t
 	if !ts.Ok {
 		m.exitCode = 1
 	}
+
+	done := 0
 	for _, tr := range m.testResult {
-		if tr == nil {
-			return
+		if tr != nil {
+			done++
 		}
 	}
+	if f, ok := m.Formatter.(ProgressFormatter); ok {
+		f.Progress(t, done, len(m.testResult))
+	}
+	if done == len(m.testResult) {
+		m.finish()
+	}
+}
+
+// flakyTests returns the test files that passed only after a retry.
+func (m *Master) flakyTests() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	paths := []string{}
+	for path, t := range m.testResult {
+		if t != nil && t.Flaky {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Abort stops dispatching test files, tells the slaves to abort their running
+// tests and makes Run report the tests finished so far.
+func (m *Master) Abort() {
+	m.abort("aborted")
+}
+
+func (m *Master) abort(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.finished {
+		return
+	}
+	log.Printf("abort: %s", reason)
+	m.aborted = time.Now()
+	m.finished = true
+	m.wake()
+	m.endCh <- ErrAborted
+}
+
+func (m *Master) isAborted() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !m.aborted.IsZero()
+}
+
+// finish wakes up waiting slaves and ends the run. m.mu must be held.
+func (m *Master) finish() {
+	if m.finished {
+		return
+	}
+	m.finished = true
+	m.wake()
 	m.endCh <- nil
 }
 
-func (m *Master) initTestFiles(submitted bool, testFiles []string) {
+// durationOf converts a duration received from a slave, which is nil when the
+// slave is older than the master.
+func durationOf(d *durpb.Duration) time.Duration {
+	if d == nil {
+		return 0
+	}
+	dur, _ := ptypes.Duration(d)
+	return dur
+}
+
+// stateSelected reports whether sel is given to --state.
+func (m *Master) stateSelected(sel string) bool {
+	for _, s := range m.selectors {
+		if s == sel {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Master) initTestFiles(submitted bool, testFiles []string, mtimes []int64) {
 	if submitted {
 		return
 	}
@@ -202,6 +646,16 @@ func (m *Master) initTestFiles(submitted bool, testFiles []string) {
 		return
 	}
 
+	for i, f := range testFiles {
+		if i < len(mtimes) {
+			m.mtimes[f] = mtimes[i]
+		}
+	}
+	if m.state != nil {
+		testFiles = m.state.selectFiles(testFiles, m.mtimes, m.selectors)
+		log.Printf("state: selected %d test files", len(testFiles))
+	}
+
 	m.testFiles = []string{}
 	for _, f := range testFiles {
 		if _, ok := m.testResult[f]; ok {
@@ -212,14 +666,15 @@ func (m *Master) initTestFiles(submitted bool, testFiles []string) {
 		m.testResult[f] = nil
 	}
 
-	go func() {
-		for _, path := range m.testFiles {
-			m.testFileCh <- path
-		}
-		close(m.testFileCh)
-	}()
+	// --state=slow already ordered the files, the other selectors only
+	// filter them
+	if m.timings != nil && !m.stateSelected("slow") {
+		m.timings.sort(m.testFiles)
+	}
+	m.pending = append(m.pending, m.testFiles...)
+	m.wake()
 
 	if len(m.testFiles) == 0 {
-		m.endCh <- nil
+		m.finish()
 	}
 }
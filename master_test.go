@@ -0,0 +1,468 @@
+package eupho
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mix3/eupho/test"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	pet "gopkg.in/mix3/pet.v3"
+)
+
+func TestLease_expire(t *testing.T) {
+	m := NewMaster()
+	m.opts.LeaseTimeout = time.Minute
+	m.initTestFiles(false, []string{"t/01.t", "t/02.t"}, nil)
+
+	ctx := context.Background()
+	l, err := m.nextLease(ctx, "slave-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.path != "t/01.t" || l.id != 1 {
+		t.Fatalf("want t/01.t with lease 1\ngot %s with lease %d", l.path, l.id)
+	}
+
+	// nothing expires before the deadline
+	m.expireLeases(time.Now())
+	l = mustLease(t, m, "slave-b")
+	if l.path != "t/02.t" || l.id != 2 {
+		t.Fatalf("want t/02.t with lease 2\ngot %s with lease %d", l.path, l.id)
+	}
+	m.EndCheck(l.path, &pet.Testsuite{Ok: true})
+
+	m.expireLeases(time.Now().Add(2 * time.Minute))
+	l = mustLease(t, m, "slave-b")
+	if l.path != "t/01.t" || l.id != 3 {
+		t.Errorf("want t/01.t to be re-dispatched with lease 3\ngot %s with lease %d", l.path, l.id)
+	}
+}
+
+// mustLease returns the next lease of holder, and fails the test when every
+// file has a result.
+func mustLease(t *testing.T, m *Master, holder string) *lease {
+	l, err := m.nextLease(context.Background(), holder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l == nil {
+		t.Fatalf("want a lease for %s\ngot none", holder)
+	}
+	return l
+}
+
+func TestLease_disconnect(t *testing.T) {
+	m := NewMaster()
+	m.opts.LeaseTimeout = time.Minute
+	m.initTestFiles(false, []string{"t/01.t"}, nil)
+
+	ctx := context.Background()
+	first := mustLease(t, m, "slave-a")
+	m.releaseLeases("slave-a", "disconnected")
+	l := mustLease(t, m, "slave-b")
+	if l.path != "t/01.t" || l.id == first.id {
+		t.Fatalf("want t/01.t to be re-dispatched with a new lease\ngot %s with lease %d", l.path, l.id)
+	}
+	path := l.path
+
+	// a late result from the first slave leaves the lease of the second
+	// slave alone, by the lease ID or by the holder
+	m.endCheck("slave-a", first.id, &test.Test{Path: path, Suite: &pet.Testsuite{Ok: false}})
+	m.endCheck("slave-a", 0, &test.Test{Path: path, Suite: &pet.Testsuite{Ok: false}})
+	if m.testResult[path] != nil || m.leases[path] != l {
+		t.Fatalf("want the stale results to be dropped\ngot %v, lease %v", m.testResult[path], m.leases[path])
+	}
+
+	// the result of the second slave is kept and the duplicate dropped
+	m.endCheck("slave-b", l.id, &test.Test{Path: path, Suite: &pet.Testsuite{Ok: true}})
+	m.EndCheck(path, &pet.Testsuite{Ok: false})
+	if !m.testResult[path].Suite.Ok {
+		t.Error("want the first result to be kept")
+	}
+	if err := <-m.endCh; err != nil {
+		t.Error(err)
+	}
+
+	if l, _ := m.nextLease(ctx, "slave-a"); l != nil {
+		t.Errorf("want no lease after the run finished\ngot %s", l.path)
+	}
+}
+
+func TestRegistry_heartbeat(t *testing.T) {
+	m := NewMaster()
+	m.opts.LeaseTimeout = time.Minute
+	m.opts.SlaveTimeout = time.Minute
+	m.initTestFiles(false, []string{"t/01.t"}, nil)
+
+	ctx := context.Background()
+	res, err := m.Register(ctx, &RegisterRequest{Hostname: "host", Jobs: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SlaveId != "host-1" {
+		t.Errorf("want host-1\ngot %s", res.SlaveId)
+	}
+
+	l := mustLease(t, m, m.holder(ctx, res.SlaveId))
+	path := l.path
+	if m.leases[path] != l {
+		t.Fatalf("want the lease %d of %s to be held", l.id, path)
+	}
+	l.deadline = time.Now()
+
+	// a heartbeat keeps the lease of a running file
+	_, err = m.Heartbeat(ctx, &HeartbeatRequest{SlaveId: res.SlaveId, Running: []string{path}, RunId: res.RunId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.expireLeases(time.Now())
+	if _, ok := m.leases[path]; !ok {
+		t.Fatal("want the lease to be extended by the heartbeat")
+	}
+
+	// a slave without heartbeats is dropped and its files are re-dispatched
+	m.expireSlaves(time.Now().Add(2 * time.Minute))
+	if !m.slaves[res.SlaveId].Dropped {
+		t.Error("want the slave to be dropped")
+	}
+	if len(m.pending) != 1 || m.pending[0] != path {
+		t.Errorf("want %s to be re-dispatched\ngot %v", path, m.pending)
+	}
+
+	if _, err := m.Heartbeat(ctx, &HeartbeatRequest{SlaveId: "unknown-1"}); err == nil {
+		t.Error("want an error for an unknown slave")
+	}
+}
+
+func TestRetryFailed(t *testing.T) {
+	m := NewMaster()
+	m.opts.LeaseTimeout = time.Minute
+	m.opts.RetryFailed = 1
+	m.initTestFiles(false, []string{"t/01.t", "t/02.t"}, nil)
+
+	first := mustLease(t, m, "slave-a")
+	path := first.path
+	m.endCheck("slave-a", 0, &test.Test{Path: path, Suite: &pet.Testsuite{Ok: false}})
+	if m.testResult[path] != nil {
+		t.Fatal("want the failed file to be retried")
+	}
+
+	// the retried file is handed to another slave first
+	if l := mustLease(t, m, "slave-a"); l.path != "t/02.t" {
+		t.Errorf("want t/02.t\ngot %s", l.path)
+	}
+	if l := mustLease(t, m, "slave-b"); l.path != path || l.id == first.id {
+		t.Errorf("want %s with a new lease\ngot %s with lease %d", path, l.path, l.id)
+	}
+	m.endCheck("slave-b", 0, &test.Test{Path: path, Suite: &pet.Testsuite{Ok: true}})
+	m.endCheck("slave-a", 0, &test.Test{Path: "t/02.t", Suite: &pet.Testsuite{Ok: true}})
+
+	if flaky := m.flakyTests(); len(flaky) != 1 || flaky[0] != path {
+		t.Errorf("want [%s] to be flaky\ngot %v", path, flaky)
+	}
+	if m.attempts[path] != 2 {
+		t.Errorf("want 2 attempts\ngot %d", m.attempts[path])
+	}
+	if m.exitCode != 0 {
+		t.Errorf("want exit code 0\ngot %d", m.exitCode)
+	}
+}
+
+func TestResult_resent(t *testing.T) {
+	m := NewMaster()
+	m.opts.Quiet = true
+	m.opts.LeaseTimeout = time.Minute
+	m.opts.RetryFailed = 1
+	m.timeouter = time.NewTimer(time.Minute)
+	m.initTestFiles(false, []string{"t/01.t"}, nil)
+
+	ctx := context.Background()
+	res, err := m.GetTest(ctx, &GetTestRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.LeaseId == 0 {
+		t.Fatal("want a lease ID")
+	}
+
+	// the stream delivered the result but failed to close, so the slave
+	// sends the result again
+	req := &ResultRequest{Path: res.Path, LeaseId: res.LeaseId, Testsuite: &pet.Testsuite{Ok: false}}
+	for i := 0; i < 2; i++ {
+		if _, err := m.Result(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if m.failures[res.Path] != 1 {
+		t.Errorf("want the failure to be counted once\ngot %d", m.failures[res.Path])
+	}
+	if len(m.pending) != 1 || m.testResult[res.Path] != nil {
+		t.Errorf("want the file to be retried once\ngot pending %v", m.pending)
+	}
+
+	retry, err := m.GetTest(ctx, &GetTestRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retry.LeaseId == res.LeaseId {
+		t.Errorf("want a new lease ID for the retry\ngot %d", retry.LeaseId)
+	}
+	if _, err := m.Result(ctx, &ResultRequest{Path: retry.Path, LeaseId: retry.LeaseId, Testsuite: &pet.Testsuite{Ok: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if r := m.testResult[res.Path]; r == nil || !r.Flaky || r.Attempts != 2 {
+		t.Errorf("want a flaky result after 2 attempts\ngot %+v", r)
+	}
+}
+
+func TestAbort(t *testing.T) {
+	m := NewMaster()
+	m.opts.LeaseTimeout = time.Minute
+	m.initTestFiles(false, []string{"t/01.t", "t/02.t"}, nil)
+
+	ctx := context.Background()
+	res, _ := m.Register(ctx, &RegisterRequest{Hostname: "host"})
+	path := mustLease(t, m, m.holder(ctx, res.SlaveId)).path
+
+	m.Abort()
+	if err := <-m.endCh; err != ErrAborted {
+		t.Errorf("want %v\ngot %v", ErrAborted, err)
+	}
+
+	// no more files are dispatched and the slaves are told to abort
+	if l, _ := m.nextLease(ctx, res.SlaveId); l != nil {
+		t.Errorf("want no lease after abort\ngot %s", l.path)
+	}
+	hb, err := m.Heartbeat(ctx, &HeartbeatRequest{SlaveId: res.SlaveId, Running: []string{path}, RunId: res.RunId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hb.Abort {
+		t.Error("want the heartbeat to tell the slave to abort")
+	}
+}
+
+func TestRegister_verify(t *testing.T) {
+	m := NewMaster()
+	m.opts.Verify = true
+	m.opts.LeaseTimeout = time.Minute
+	m.timeouter = time.NewTimer(time.Minute)
+	m.expected = &checkout{
+		TestFilesHash: testFilesHash([]string{"t/01.t", "t/02.t"}),
+		Revision:      "0123456789abcdef",
+		source:        "the master",
+	}
+	m.initTestFiles(false, []string{"t/01.t", "t/02.t"}, nil)
+
+	ctx := context.Background()
+	res, err := m.Register(ctx, &RegisterRequest{
+		Hostname:      "same",
+		TestFilesHash: testFilesHash([]string{"t/02.t", "t/01.t"}),
+		Revision:      "0123456789abcdef",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetTest(ctx, &GetTestRequest{SlaveId: res.SlaveId, RunId: res.RunId}); err != nil {
+		t.Error(err)
+	}
+
+	for _, req := range []*RegisterRequest{
+		{Hostname: "files", TestFilesHash: testFilesHash([]string{"t/01.t"}), Revision: "0123456789abcdef"},
+		{Hostname: "revision", TestFilesHash: testFilesHash([]string{"t/01.t", "t/02.t"}), Revision: "fedcba9876543210"},
+	} {
+		_, err := m.Register(ctx, req)
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("%s: want FailedPrecondition\ngot %v", req.Hostname, err)
+		}
+	}
+	if len(m.slaves) != 1 {
+		t.Errorf("want only the matching slave to be registered\ngot %d slaves", len(m.slaves))
+	}
+
+	// slaves that did not register are not verified
+	if _, err := m.GetTest(ctx, &GetTestRequest{SlaveId: ""}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("want PermissionDenied\ngot %v", err)
+	}
+}
+
+func TestRunID(t *testing.T) {
+	m := NewMaster()
+	m.opts.LeaseTimeout = time.Minute
+	m.timeouter = time.NewTimer(time.Minute)
+	m.initTestFiles(false, []string{"t/01.t", "t/02.t"}, nil)
+
+	ctx := context.Background()
+	res, err := m.Register(ctx, &RegisterRequest{Hostname: "current"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RunId == "" || res.RunId != m.runID {
+		t.Errorf("want the run ID %q\ngot %q", m.runID, res.RunId)
+	}
+	get, err := m.GetTest(ctx, &GetTestRequest{SlaveId: res.SlaveId, RunId: res.RunId})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a slave of a previous run is told to exit
+	if _, err := m.Register(ctx, &RegisterRequest{Hostname: "stale", RunId: "previous"}); !isOtherRun(err) {
+		t.Errorf("Register: want Aborted\ngot %v", err)
+	}
+	if _, err := m.Heartbeat(ctx, &HeartbeatRequest{SlaveId: res.SlaveId, RunId: "previous"}); !isOtherRun(err) {
+		t.Errorf("Heartbeat: want Aborted\ngot %v", err)
+	}
+	if _, err := m.GetTest(ctx, &GetTestRequest{SlaveId: res.SlaveId, RunId: "previous"}); !isOtherRun(err) {
+		t.Errorf("GetTest: want Aborted\ngot %v", err)
+	}
+	_, err = m.Result(ctx, &ResultRequest{
+		Path:      get.Path,
+		SlaveId:   res.SlaveId,
+		RunId:     "previous",
+		Testsuite: &pet.Testsuite{Ok: false, Plan: 1},
+	})
+	if !isOtherRun(err) {
+		t.Errorf("Result: want Aborted\ngot %v", err)
+	}
+	if m.testResult[get.Path] != nil {
+		t.Errorf("want the result of the previous run to be rejected\ngot %v", m.testResult[get.Path])
+	}
+
+	// once registered, a slave has to send its run ID
+	if _, err := m.Heartbeat(ctx, &HeartbeatRequest{SlaveId: res.SlaveId}); !isOtherRun(err) {
+		t.Errorf("Heartbeat without run ID: want Aborted\ngot %v", err)
+	}
+	if _, err := m.GetTest(ctx, &GetTestRequest{SlaveId: res.SlaveId}); !isOtherRun(err) {
+		t.Errorf("GetTest without run ID: want Aborted\ngot %v", err)
+	}
+	_, err = m.Result(ctx, &ResultRequest{Path: get.Path, SlaveId: res.SlaveId, Testsuite: &pet.Testsuite{Ok: false, Plan: 1}})
+	if !isOtherRun(err) {
+		t.Errorf("Result without run ID: want Aborted\ngot %v", err)
+	}
+	if _, err := m.Register(ctx, &RegisterRequest{Hostname: "new"}); err != nil {
+		t.Errorf("Register without run ID: want no error\ngot %v", err)
+	}
+
+	_, err = m.Result(ctx, &ResultRequest{
+		Path:      get.Path,
+		SlaveId:   res.SlaveId,
+		RunId:     res.RunId,
+		Testsuite: &pet.Testsuite{Ok: true, Plan: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := m.testResult[get.Path]; r == nil || r.RunID != m.runID {
+		t.Errorf("want the result to have the run ID %q\ngot %v", m.runID, r)
+	}
+}
+
+func TestInitTestFiles_order(t *testing.T) {
+	newMaster := func(selectors ...string) *Master {
+		m := NewMaster()
+		m.timeouter = time.NewTimer(time.Minute)
+		m.timings = timings{"t/01.t": 1, "t/02.t": 3, "t/03.t": 2}
+		m.selectors = selectors
+		m.state = &state{Tests: map[string]*testState{
+			"t/01.t": {Result: "pass", Elapsed: 3},
+			"t/02.t": {Result: "fail", Elapsed: 1},
+			"t/03.t": {Result: "fail", Elapsed: 2},
+		}}
+		if len(selectors) == 0 {
+			m.state = nil
+		}
+		return m
+	}
+	files := []string{"t/01.t", "t/02.t", "t/03.t"}
+
+	for _, tc := range []struct {
+		selectors []string
+		want      []string
+	}{
+		// the timings order the files
+		{nil, []string{"t/02.t", "t/03.t", "t/01.t"}},
+		{[]string{"failed"}, []string{"t/02.t", "t/03.t"}},
+		// --state=slow takes precedence over the timings
+		{[]string{"slow"}, []string{"t/01.t", "t/03.t", "t/02.t"}},
+		{[]string{"failed", "slow"}, []string{"t/03.t", "t/02.t"}},
+	} {
+		m := newMaster(tc.selectors...)
+		m.initTestFiles(false, files, nil)
+		if !reflect.DeepEqual(m.pending, tc.want) {
+			t.Errorf("%v: want %v\ngot %v", tc.selectors, tc.want, m.pending)
+		}
+	}
+}
+
+func TestProgress_partial(t *testing.T) {
+	m := NewMaster()
+	m.opts.Quiet = true
+	m.initTestFiles(false, []string{"t/01.t"}, nil)
+
+	m.startPartial("t/01.t")
+	m.progress("t/01.t", &pet.Testline{Ok: true, Num: 1})
+	m.progress("t/01.t", &pet.Testline{Ok: false, Num: 2})
+
+	// the slave died before sending the testsuite
+	suite := m.partialSuite("t/01.t")
+	if suite == nil {
+		t.Fatal("want the partial result to be kept")
+	}
+	if suite.Ok {
+		t.Error("want fail\ngot success")
+	}
+	if len(suite.Tests) != 2 {
+		t.Errorf("want 2\ngot %d", len(suite.Tests))
+	}
+
+	m.EndCheck("t/01.t", &pet.Testsuite{Ok: true})
+	if m.partialSuite("t/01.t") != nil {
+		t.Error("want the partial result to be dropped once the result arrived")
+	}
+}
+
+func TestRunContext_timeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := DefaultMasterConfig()
+	c.Addr = "127.0.0.1:0"
+	c.Timeout = 100 * time.Millisecond
+	c.Quiet = true
+	c.Formatter = []string{"json:" + filepath.Join(dir, "report.json")}
+	m, err := NewMasterWithConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.initTestFiles(false, []string{"t/01.t"}, nil)
+
+	res, err := m.RunContext(context.Background())
+	if err != ErrTimeout {
+		t.Fatalf("want %v\ngot %v", ErrTimeout, err)
+	}
+	if res.ExitCode != 1 || len(res.NotFinished) != 1 {
+		t.Errorf("want exit code 1 and t/01.t not finished\ngot %+v", res)
+	}
+
+	// the run is over and the lease watcher stopped
+	if !m.finished {
+		t.Error("want the run to be finished")
+	}
+	select {
+	case <-m.watched:
+	default:
+		t.Error("want the lease watcher to be stopped")
+	}
+	if l, _ := m.nextLease(context.Background(), "slave-a"); l != nil {
+		t.Errorf("want no lease after the timeout\ngot %s", l.path)
+	}
+}
@@ -0,0 +1,340 @@
+package eupho
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/jessevdk/go-flags"
+	"github.com/mix3/eupho/formatter"
+	"github.com/mix3/eupho/test"
+	"golang.org/x/net/context"
+	pet "gopkg.in/mix3/pet.v3"
+)
+
+// Merge combines the reports of several runs, such as the shards of a test
+// suite run by independent CI jobs, into one report and exit code.
+type Merge struct {
+	Formatter Formatter
+
+	opts MergeConfig
+}
+
+// MergeConfig is the configuration of a merge. ParseArgs fills it from the
+// command line options.
+type MergeConfig struct {
+	Formatter []string `long:"formatter" description:"Result formatter to use as name[=args][:path], console by default. Can be given multiple times"`
+
+	// Args are the json or junit reports to merge.
+	Args []string
+}
+
+func NewMerge() *Merge {
+	return &Merge{}
+}
+
+// NewMergeWithConfig returns a merge configured by c instead of ParseArgs.
+func NewMergeWithConfig(c MergeConfig) (*Merge, error) {
+	m := NewMerge()
+	if err := m.configure(c); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Merge) ParseArgs(args []string) error {
+	var opts MergeConfig
+	parser := flags.NewParser(
+		&opts,
+		flags.HelpFlag|flags.PassDoubleDash,
+	)
+	parser.Usage = "[OPTIONS] json-or-junit-reports..."
+	describeFormatters(parser)
+	rest, err := parser.ParseArgs(args)
+	if err != nil {
+		return err
+	}
+	opts.Args = rest
+
+	return m.configure(opts)
+}
+
+func (m *Merge) configure(c MergeConfig) error {
+	if err := checkFormatters(c.Formatter); err != nil {
+		return &ConfigError{Option: "formatter", Err: err}
+	}
+	m.opts = c
+	return nil
+}
+
+// Run merges the reports from the command line and returns the exit code.
+func (m *Merge) Run(args []string) int {
+	if args != nil {
+		if err := m.ParseArgs(args); err != nil {
+			return parseFailed(err)
+		}
+	}
+
+	res, err := m.RunContext(context.Background())
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	return res.ExitCode
+}
+
+// RunContext loads the reports and gives the tests in them to the formatter.
+// The test files which did not finish in any report are not finished in the
+// merged result, and it fails when any report has a non-zero exit code.
+func (m *Merge) RunContext(ctx context.Context) (*RunResult, error) {
+	tests := map[string]*test.Test{}
+	notFinished := map[string]bool{}
+	exitCode := 0
+	for _, file := range m.opts.Args {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		loaded, err := loadReport(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %v", file, err)
+		}
+		for _, t := range loaded.Tests {
+			if _, ok := tests[t.Path]; ok {
+				log.Printf("ignore: %s in %s (already merged)", t.Path, file)
+				continue
+			}
+			tests[t.Path] = t
+		}
+		for _, path := range loaded.NotFinished {
+			notFinished[path] = true
+		}
+		if exitCode == 0 && loaded.ExitCode != 0 {
+			log.Printf("%s: exit code %d", file, loaded.ExitCode)
+			exitCode = loaded.ExitCode
+		}
+	}
+
+	f, closers, err := openFormatters(m.opts.Formatter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open formatters: %v", err)
+	}
+	defer closeAll(closers)
+	m.Formatter = f
+
+	merged := make([]*test.Test, 0, len(tests))
+	for _, t := range tests {
+		merged = append(merged, t)
+	}
+	unfinished := []string{}
+	for path := range notFinished {
+		if _, ok := tests[path]; !ok {
+			unfinished = append(unfinished, path)
+		}
+	}
+	sort.Strings(unfinished)
+	res := newRunResult(merged, unfinished, exitCode)
+	if !res.Ok() && res.ExitCode == 0 {
+		res.ExitCode = 1
+	}
+
+	for i, t := range res.Results {
+		if pf, ok := m.Formatter.(ProgressFormatter); ok {
+			pf.Progress(t, i+1, len(res.Results))
+		}
+		m.Formatter.OpenTest(t)
+	}
+	if rf, ok := m.Formatter.(ResultFormatter); ok {
+		rf.SetResult(res)
+	}
+	m.Formatter.Report()
+
+	return res, nil
+}
+
+// shardReport is what a report of a shard gives to the merge.
+type shardReport struct {
+	Tests       []*test.Test
+	NotFinished []string
+	ExitCode    int
+}
+
+// loadReport reads the results of a json formatter or a junit formatter.
+func loadReport(file string) (*shardReport, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	b = bytes.TrimSpace(b)
+	if bytes.HasPrefix(b, []byte("{")) {
+		return loadJSONReport(b)
+	}
+	if bytes.HasPrefix(b, []byte("<")) {
+		return loadJUnitReport(b)
+	}
+	return nil, fmt.Errorf("neither a json nor a junit report")
+}
+
+// loadJSONReport rebuilds the tests of a json report. The files which did not
+// finish and the exit code are only in the reports with a summary.
+func loadJSONReport(b []byte) (*shardReport, error) {
+	var report formatter.JSONReport
+	if err := json.Unmarshal(b, &report); err != nil {
+		return nil, err
+	}
+
+	shard := &shardReport{Tests: []*test.Test{}}
+	if s := report.Summary; s != nil {
+		shard.NotFinished = s.NotFinished
+		shard.ExitCode = s.ExitCode
+	}
+	for _, r := range report.Results {
+		suite := &pet.Testsuite{
+			Ok:      r.Ok,
+			Plan:    r.Plan,
+			Version: r.Version,
+			Time:    ptypes.DurationProto(seconds(r.Time)),
+		}
+		for _, l := range r.Tests {
+			line := &pet.Testline{
+				Ok:          l.Ok,
+				Num:         l.Num,
+				Description: l.Description,
+				Explanation: l.Explanation,
+				Diagnostic:  l.Diagnostic,
+				Time:        ptypes.DurationProto(seconds(l.Time)),
+			}
+			switch l.Directive {
+			case "TODO":
+				line.Directive = pet.Testline_TODO
+			case "SKIP":
+				line.Directive = pet.Testline_SKIP
+			}
+			suite.Tests = append(suite.Tests, line)
+		}
+		shard.Tests = append(shard.Tests, &test.Test{
+			Path:       r.Path,
+			Suite:      suite,
+			Slave:      r.Slave,
+			RunID:      r.RunID,
+			Attempts:   r.Attempts,
+			Flaky:      r.Flaky,
+			UserTime:   seconds(r.UserTime),
+			SystemTime: seconds(r.SystemTime),
+		})
+	}
+	return shard, nil
+}
+
+// resultLine parses the TAP result line which the junit formatter writes
+// first to the system-out of each testcase.
+var resultLine = regexp.MustCompile(`^(not )?ok (\d+)(?: - (.*?))?(?: # (TODO|SKIP)(?: (.*))?)?$`)
+
+// loadJUnitReport rebuilds the test lines from the testcases. The check of
+// the plan added by the junit formatter only marks the testsuite as failed,
+// and a testsuite of a file which did not finish has no test lines.
+// The test paths come from the file attribute, so the reports have to be
+// written with the file option.
+func loadJUnitReport(b []byte) (*shardReport, error) {
+	var report formatter.JUnitTestSuites
+	if err := xml.Unmarshal(b, &report); err != nil {
+		return nil, err
+	}
+
+	shard := &shardReport{Tests: []*test.Test{}}
+	for _, ts := range report.Suites {
+		if ts.File == "" {
+			return nil, fmt.Errorf("testsuite %s has no test path, write the report with --formatter junit=file to merge it", ts.Name)
+		}
+		if len(ts.TestCases) == 1 && ts.TestCases[0].Failure != nil && ts.TestCases[0].Failure.Type == "NotFinished" {
+			shard.NotFinished = append(shard.NotFinished, ts.File)
+			continue
+		}
+		suite := &pet.Testsuite{
+			Ok:      ts.Failures == 0 && ts.Errors == 0,
+			Version: pet.DefaultTAPVersion,
+			Time:    ptypes.DurationProto(parseSeconds(ts.Time)),
+		}
+		for _, tc := range ts.TestCases {
+			if tc.Failure != nil && tc.Failure.Type == "Plan" {
+				continue
+			}
+			line := &pet.Testline{
+				Ok:          tc.Failure == nil,
+				Num:         int32(len(suite.Tests) + 1),
+				Description: tc.Name,
+				Time:        ptypes.DurationProto(parseSeconds(tc.Time)),
+			}
+			if tc.Failure != nil {
+				line.Diagnostic = tc.Failure.Contents
+			}
+			if m := tc.SkipMessage; m != nil && strings.HasPrefix(m.Message, "TODO") {
+				// only a failing TODO test is reported as skipped
+				line.Ok = false
+				line.Directive = pet.Testline_TODO
+				line.Explanation = strings.TrimSpace(strings.TrimPrefix(m.Message, "TODO"))
+			} else if m != nil {
+				line.Ok = true
+				line.Directive = pet.Testline_SKIP
+				line.Explanation = m.Message
+			}
+			if tc.SystemOut != nil {
+				parseResultLine(line, tc.SystemOut.Contents)
+			}
+			suite.Tests = append(suite.Tests, line)
+		}
+		suite.Plan = int32(len(suite.Tests))
+
+		t := &test.Test{Path: ts.File, Suite: suite, Hostname: ts.Hostname}
+		if ts.SystemOut != nil {
+			t.Stdout = []byte(ts.SystemOut.Contents)
+		}
+		if ts.SystemErr != nil {
+			t.Stderr = []byte(ts.SystemErr.Contents)
+		}
+		shard.Tests = append(shard.Tests, t)
+	}
+	return shard, nil
+}
+
+// parseResultLine restores a test line from the system-out of its testcase,
+// which keeps whether a TODO test passed. Other output is left alone.
+func parseResultLine(line *pet.Testline, out string) {
+	a := strings.SplitN(out, "\n", 2)
+	r := resultLine.FindStringSubmatch(a[0])
+	if r == nil {
+		return
+	}
+	num, _ := strconv.Atoi(r[2])
+	line.Ok = r[1] == ""
+	line.Num = int32(num)
+	line.Description = r[3]
+	line.Directive = pet.Testline_NONE
+	line.Explanation = r[5]
+	switch r[4] {
+	case "TODO":
+		line.Directive = pet.Testline_TODO
+	case "SKIP":
+		line.Directive = pet.Testline_SKIP
+	}
+	if len(a) == 2 {
+		line.Diagnostic = a[1]
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+func parseSeconds(s string) time.Duration {
+	f, _ := strconv.ParseFloat(s, 64)
+	return seconds(f)
+}
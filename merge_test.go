@@ -0,0 +1,202 @@
+package eupho
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mix3/eupho/formatter"
+	"github.com/mix3/eupho/test"
+	"golang.org/x/net/context"
+	pet "gopkg.in/mix3/pet.v3"
+)
+
+func TestMerge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var shard0 bytes.Buffer
+	jf := &formatter.JSONFormatter{}
+	jf.SetOutput(&shard0)
+	jf.OpenTest(&test.Test{
+		Path: "t/01.t",
+		Suite: &pet.Testsuite{Ok: true, Plan: 2, Tests: []*pet.Testline{
+			{Ok: true, Num: 1},
+			{Ok: false, Num: 2, Directive: pet.Testline_TODO, Explanation: "later"},
+		}},
+	})
+	jf.Report()
+
+	var shard1 bytes.Buffer
+	uf := &formatter.JUnitFormatter{Options: formatter.JUnitOptions{File: true}}
+	uf.SetOutput(&shard1)
+	uf.OpenTest(&test.Test{
+		Path: "t/02.t",
+		Suite: &pet.Testsuite{Ok: false, Plan: 2, Tests: []*pet.Testline{
+			{Ok: true, Num: 1, Description: "first"},
+			{Ok: false, Num: 2, Description: "second", Diagnostic: "# failed"},
+		}},
+	})
+	uf.Report()
+
+	files := []string{filepath.Join(dir, "shard0.json"), filepath.Join(dir, "shard1.xml")}
+	ioutil.WriteFile(files[0], shard0.Bytes(), 0644)
+	ioutil.WriteFile(files[1], shard1.Bytes(), 0644)
+
+	out := filepath.Join(dir, "merged.json")
+	m := NewMerge()
+	code := m.Run(append([]string{"--formatter", "json:" + out}, files...))
+	if code != 1 {
+		t.Errorf("want exit code 1\ngot %d", code)
+	}
+
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadJSONReport(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := loaded.Tests
+	if len(tests) != 2 || tests[0].Path != "t/01.t" || tests[1].Path != "t/02.t" {
+		t.Fatalf("want t/01.t and t/02.t\ngot %s", b)
+	}
+	if line := tests[0].Suite.Tests[1]; line.Directive != pet.Testline_TODO || line.Explanation != "later" {
+		t.Errorf("want the TODO test to be kept\ngot %#v", line)
+	}
+	if suite := tests[1].Suite; suite.Ok || len(suite.Tests) != 2 || suite.Tests[1].Diagnostic != "# failed" {
+		t.Errorf("want the failure from the junit report\ngot %s", b)
+	}
+
+	if _, err := loadReport(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("want an error for a missing report")
+	}
+	ioutil.WriteFile(filepath.Join(dir, "broken"), []byte("1..1\nok 1\n"), 0644)
+	if _, err := loadReport(filepath.Join(dir, "broken")); err == nil || !strings.Contains(err.Error(), "neither") {
+		t.Errorf("want an error for an unknown report\ngot %v", err)
+	}
+}
+
+func TestLoadJUnitReport(t *testing.T) {
+	lines := []*pet.Testline{
+		{Ok: true, Num: 1, Description: "first"},
+		{Ok: false, Num: 2, Description: "todo", Directive: pet.Testline_TODO, Explanation: "later", Diagnostic: "# not yet"},
+		{Ok: true, Num: 3, Directive: pet.Testline_TODO, Explanation: "bonus"},
+		{Ok: true, Num: 4, Directive: pet.Testline_SKIP, Explanation: "no db"},
+		{Ok: false, Num: 5, Description: "last", Diagnostic: "# failed"},
+	}
+
+	var b bytes.Buffer
+	uf := &formatter.JUnitFormatter{Options: formatter.JUnitOptions{File: true}}
+	uf.SetOutput(&b)
+	uf.OpenTest(&test.Test{
+		Path:  "t/01.t",
+		Suite: &pet.Testsuite{Ok: false, Plan: 5, Tests: lines},
+	})
+	uf.Report()
+
+	loaded, err := loadJUnitReport(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := loaded.Tests
+	if len(tests) != 1 || tests[0].Path != "t/01.t" {
+		t.Fatalf("want t/01.t\ngot %s", b.Bytes())
+	}
+	got := tests[0].Suite.Tests
+	if len(got) != len(lines) {
+		t.Fatalf("want %d test lines\ngot %d", len(lines), len(got))
+	}
+	for i, want := range lines {
+		if got[i].Ok != want.Ok || got[i].Num != want.Num || got[i].Description != want.Description ||
+			got[i].Directive != want.Directive || got[i].Explanation != want.Explanation || got[i].Diagnostic != want.Diagnostic {
+			t.Errorf("want %s\ngot  %s", want.ResultString(), got[i].ResultString())
+		}
+	}
+	res := newRunResult(tests, nil, 0)
+	if res.Todos != 2 || res.BonusPasses != 1 || res.Skips != 1 || res.Failures != 1 {
+		t.Errorf("want 2 todos, 1 bonus pass, 1 skip and 1 failure\ngot %+v", res)
+	}
+
+	// without the file option the test paths are lost
+	b.Reset()
+	uf = &formatter.JUnitFormatter{}
+	uf.SetOutput(&b)
+	uf.OpenTest(&test.Test{Path: "t/01.t", Suite: &pet.Testsuite{Ok: true, Plan: 1, Tests: lines[:1]}})
+	uf.Report()
+	if _, err := loadJUnitReport(b.Bytes()); err == nil || !strings.Contains(err.Error(), "junit=file") {
+		t.Errorf("want an error for a report without the file option\ngot %v", err)
+	}
+}
+
+func TestMerge_notFinished(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	passed := &test.Test{
+		Path:  "t/01.t",
+		Suite: &pet.Testsuite{Ok: true, Plan: 1, Tests: []*pet.Testline{{Ok: true, Num: 1}}},
+	}
+
+	// a shard which timed out before t/02.t finished
+	var shard0 bytes.Buffer
+	jf := &formatter.JSONFormatter{}
+	jf.SetOutput(&shard0)
+	jf.OpenTest(passed)
+	jf.SetResult(&formatter.RunResult{ExitCode: 1, Results: []*test.Test{passed}, NotFinished: []string{"t/02.t"}, Files: 1, Tests: 1})
+	jf.Report()
+
+	// a shard which was aborted before t/03.t finished
+	var shard1 bytes.Buffer
+	uf := &formatter.JUnitFormatter{Options: formatter.JUnitOptions{File: true}}
+	uf.SetOutput(&shard1)
+	uf.SetResult(&formatter.RunResult{ExitCode: 1, NotFinished: []string{"t/03.t"}})
+	uf.Report()
+
+	files := []string{filepath.Join(dir, "shard0.json"), filepath.Join(dir, "shard1.xml")}
+	ioutil.WriteFile(files[0], shard0.Bytes(), 0644)
+	ioutil.WriteFile(files[1], shard1.Bytes(), 0644)
+
+	m, err := NewMergeWithConfig(MergeConfig{Formatter: []string{"json:" + filepath.Join(dir, "merged.json")}, Args: files})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := m.RunContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ExitCode == 0 || res.Ok() {
+		t.Errorf("want the merged run to fail\ngot %+v", res)
+	}
+	if len(res.Results) != 1 || !reflect.DeepEqual(res.NotFinished, []string{"t/02.t", "t/03.t"}) {
+		t.Errorf("want t/01.t with a result and t/02.t, t/03.t not finished\ngot %+v", res)
+	}
+
+	// the exit code of a shard fails the merge even when its files passed
+	var shard2 bytes.Buffer
+	jf = &formatter.JSONFormatter{}
+	jf.SetOutput(&shard2)
+	jf.OpenTest(passed)
+	jf.SetResult(&formatter.RunResult{ExitCode: 3, Results: []*test.Test{passed}, Files: 1, Tests: 1})
+	jf.Report()
+	ioutil.WriteFile(files[0], shard2.Bytes(), 0644)
+
+	m, err = NewMergeWithConfig(MergeConfig{Formatter: []string{"json:" + filepath.Join(dir, "merged.json")}, Args: files[:1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := m.RunContext(context.Background()); err != nil || res.ExitCode != 3 {
+		t.Errorf("want exit code 3\ngot %v, %v", res, err)
+	}
+}
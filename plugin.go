@@ -1,5 +1,7 @@
 package eupho
 
+import "fmt"
+
 type Plugin interface {
 	Run(w *Worker, f func())
 }
@@ -16,6 +18,20 @@ func (f PluginLoaderFunc) Load(name, args string) Plugin {
 
 var pluginLoaders map[string]PluginLoader = map[string]PluginLoader{}
 
+// loadPlugin loads a plugin, turning a panic of the loader into an error.
+func loadPlugin(name, args string) (p Plugin, err error) {
+	loader, ok := pluginLoaders[name]
+	if !ok {
+		return nil, fmt.Errorf("plugin %s not found", name)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to load plugin %s: %v", name, r)
+		}
+	}()
+	return loader.Load(name, args), nil
+}
+
 func AppendPluginLoader(name string, loader PluginLoader) {
 	pluginLoaders[name] = loader
 }
@@ -0,0 +1,208 @@
+package eupho
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// slaveInfo is what the master knows about a registered slave.
+type slaveInfo struct {
+	ID       string
+	Addr     string
+	Hostname string
+	Jobs     int
+	Plugins  []string
+	Version  string
+	Running  []string
+	LastSeen time.Time
+	Dropped  bool
+
+	// number of test files whose result was received from this slave
+	Done int
+}
+
+func (si *slaveInfo) String() string {
+	return fmt.Sprintf("%s(%s)", si.ID, si.Addr)
+}
+
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return "???"
+}
+
+func (m *Master) Register(ctx context.Context, req *RegisterRequest) (*RegisterResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkRegisterRun(req.RunId, fmt.Sprintf("slave %s(%s)", req.Hostname, peerAddr(ctx))); err != nil {
+		return nil, err
+	}
+	if err := m.verifySlave(req, fmt.Sprintf("%s(%s)", req.Hostname, peerAddr(ctx))); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	m.slaveSeq++
+	si := &slaveInfo{
+		ID:       fmt.Sprintf("%s-%d", req.Hostname, m.slaveSeq),
+		Addr:     peerAddr(ctx),
+		Hostname: req.Hostname,
+		Jobs:     int(req.Jobs),
+		Plugins:  req.Plugins,
+		Version:  req.Version,
+		LastSeen: time.Now(),
+	}
+	m.slaves[si.ID] = si
+
+	log.Printf(
+		"register: %s <- %s (jobs=%d plugins=[%s] version=%s)",
+		si.ID, si.Addr, si.Jobs, strings.Join(si.Plugins, ","), si.Version,
+	)
+
+	return &RegisterResponse{SlaveId: si.ID, RunId: m.runID}, nil
+}
+
+func (m *Master) Heartbeat(ctx context.Context, req *HeartbeatRequest) (*HeartbeatResponse, error) {
+	if err := m.checkRun(req.RunId, req.SlaveId, "heartbeat of "+req.SlaveId); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	si, ok := m.slaves[req.SlaveId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown slave: %s", req.SlaveId)
+	}
+	m.touchSlave(si, peerAddr(ctx))
+	si.Running = req.Running
+
+	// the slave is alive and still running these files, so keep their leases
+	deadline := si.LastSeen.Add(m.opts.LeaseTimeout)
+	for _, path := range req.Running {
+		if l, ok := m.leases[path]; ok && l.holder == si.ID {
+			l.deadline = deadline
+		}
+	}
+
+	return &HeartbeatResponse{Abort: !m.aborted.IsZero()}, nil
+}
+
+// holder returns the lease holder name of the slave calling an RPC. Slaves
+// that did not register are identified by their address.
+func (m *Master) holder(ctx context.Context, slaveID string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if si, ok := m.slaves[slaveID]; ok {
+		m.touchSlave(si, peerAddr(ctx))
+		return si.ID
+	}
+	return peerAddr(ctx)
+}
+
+// touchSlave records that si is alive and connected from addr.
+// m.mu must be held.
+func (m *Master) touchSlave(si *slaveInfo, addr string) {
+	si.LastSeen = time.Now()
+	si.Addr = addr
+	if si.Dropped {
+		log.Printf("slave is back: %s", si)
+		si.Dropped = false
+	}
+}
+
+// describe returns a human readable name of a lease holder for logging.
+// m.mu must be held.
+func (m *Master) describe(holder string) string {
+	if si, ok := m.slaves[holder]; ok {
+		return si.String()
+	}
+	return holder
+}
+
+// dropSlave marks a slave as gone and re-dispatches its leases.
+// m.mu must be held.
+func (m *Master) dropSlave(si *slaveInfo, reason string) {
+	log.Printf("drop slave: %s (%s)", si, reason)
+	si.Dropped = true
+	for path, l := range m.leases {
+		if l.holder != si.ID {
+			continue
+		}
+		log.Printf("requeue: %s (%s %s)", path, si, reason)
+		m.requeue(path)
+	}
+}
+
+// expireSlaves drops every slave that did not send a heartbeat in time.
+func (m *Master) expireSlaves(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, si := range m.slaves {
+		if si.Dropped || now.Sub(si.LastSeen) < m.opts.SlaveTimeout {
+			continue
+		}
+		m.dropSlave(si, "heartbeat timed out")
+	}
+}
+
+// disconnectSlaves drops every slave connected from addr.
+func (m *Master) disconnectSlaves(addr string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, si := range m.slaves {
+		if !si.Dropped && si.Addr == addr {
+			m.dropSlave(si, "disconnected")
+		}
+	}
+}
+
+const abortGracePeriod = 10 * time.Second
+
+// waitSlavesAborted waits until every slave has received the abort through a
+// heartbeat or disconnected.
+func (m *Master) waitSlavesAborted() {
+	deadline := time.Now().Add(abortGracePeriod)
+	for time.Now().Before(deadline) {
+		m.mu.Lock()
+		waiting := 0
+		for _, si := range m.slaves {
+			if !si.Dropped && !si.LastSeen.After(m.aborted) {
+				waiting++
+			}
+		}
+		m.mu.Unlock()
+		if waiting == 0 {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (m *Master) reportSlaves() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make([]string, 0, len(m.slaves))
+	for id := range m.slaves {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		si := m.slaves[id]
+		log.Printf("slave: %s ran %d test files", si, si.Done)
+	}
+}
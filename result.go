@@ -0,0 +1,49 @@
+package eupho
+
+import (
+	"sort"
+
+	"github.com/mix3/eupho/formatter"
+	"github.com/mix3/eupho/test"
+	pet "gopkg.in/mix3/pet.v3"
+)
+
+// RunResult is the outcome of a run. It is defined in the formatter package
+// for the formatters receiving it by SetResult.
+type RunResult = formatter.RunResult
+
+func newRunResult(tests []*test.Test, notFinished []string, exitCode int) *RunResult {
+	res := &RunResult{
+		ExitCode:    exitCode,
+		Results:     make([]*test.Test, len(tests)),
+		NotFinished: make([]string, len(notFinished)),
+		Files:       len(tests),
+	}
+	copy(res.Results, tests)
+	copy(res.NotFinished, notFinished)
+	sort.Slice(res.Results, func(i, j int) bool { return res.Results[i].Path < res.Results[j].Path })
+	sort.Strings(res.NotFinished)
+
+	for _, t := range res.Results {
+		if !t.Suite.Ok {
+			res.FailedFiles++
+		}
+		for _, line := range t.Suite.Tests {
+			res.Tests++
+			switch line.Directive {
+			case pet.Testline_TODO:
+				res.Todos++
+				if line.Ok {
+					res.BonusPasses++
+				}
+			case pet.Testline_SKIP:
+				res.Skips++
+			default:
+				if !line.Ok {
+					res.Failures++
+				}
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,67 @@
+package eupho
+
+import (
+	"io"
+	"testing"
+
+	"github.com/mix3/eupho/test"
+	pet "gopkg.in/mix3/pet.v3"
+)
+
+type resultFormatter struct {
+	res      *RunResult
+	reported bool
+}
+
+func (f *resultFormatter) OpenTest(test *test.Test) {}
+func (f *resultFormatter) SetOutput(w io.Writer)    {}
+func (f *resultFormatter) SetResult(res *RunResult) { f.res = res }
+func (f *resultFormatter) Report()                  { f.reported = f.res != nil }
+
+func TestRunResult(t *testing.T) {
+	m := NewMaster()
+	m.opts.Quiet = true
+	rf := &resultFormatter{}
+	m.Formatter = multiFormatter{&resultFormatter{}, rf}
+	m.initTestFiles(false, []string{"t/03.t", "t/01.t", "t/02.t", "t/04.t"}, nil)
+
+	m.endCheck("slave-a", 0, &test.Test{Path: "t/01.t", Suite: &pet.Testsuite{Ok: true, Tests: []*pet.Testline{
+		{Ok: true, Num: 1},
+		{Ok: true, Num: 2, Directive: pet.Testline_SKIP},
+		{Ok: true, Num: 3, Directive: pet.Testline_TODO},
+	}}})
+	m.endCheck("slave-b", 0, &test.Test{Path: "t/02.t", Suite: &pet.Testsuite{Ok: false, Tests: []*pet.Testline{
+		{Ok: false, Num: 1},
+		{Ok: false, Num: 2, Directive: pet.Testline_TODO},
+	}}})
+	// the slave of t/03.t died after a test line
+	m.startPartial("t/03.t")
+	m.progress("t/03.t", &pet.Testline{Ok: true, Num: 1})
+
+	res := m.report()
+	if rf.res != res || !rf.reported {
+		t.Error("want the result to be given to the formatter before Report")
+	}
+
+	paths := []string{}
+	for _, r := range res.Results {
+		paths = append(paths, r.Path)
+	}
+	if len(paths) != 3 || paths[0] != "t/01.t" || paths[1] != "t/02.t" || paths[2] != "t/03.t" {
+		t.Errorf("want the results sorted by path\ngot %v", paths)
+	}
+	if res.Results[0].Slave != "slave-a" {
+		t.Errorf("want slave-a\ngot %s", res.Results[0].Slave)
+	}
+	if len(res.NotFinished) != 1 || res.NotFinished[0] != "t/04.t" {
+		t.Errorf("want t/04.t not to be finished\ngot %v", res.NotFinished)
+	}
+
+	counts := [...]int{res.Files, res.FailedFiles, res.Tests, res.Failures, res.Skips, res.Todos, res.BonusPasses}
+	if counts != [...]int{3, 2, 6, 1, 1, 2, 1} {
+		t.Errorf("want files, failed files, tests, failures, skips, todos and bonus passes of [3 2 6 1 1 2 1]\ngot %v", counts)
+	}
+	if res.Ok() {
+		t.Error("want not ok")
+	}
+}
@@ -0,0 +1,52 @@
+package eupho
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newRunID returns a random ID for a run of the master.
+func newRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// checkRun rejects the RPCs of slaves registered to another run, e.g. slaves
+// of the previous CI job reconnecting to a new master. A slave which
+// registered has to send the run ID it was given, only a slave which never
+// registered may send none.
+func (m *Master) checkRun(runID, slaveID, who string) error {
+	if runID != "" {
+		return m.checkRegisterRun(runID, who)
+	}
+
+	m.mu.Lock()
+	_, registered := m.slaves[slaveID]
+	m.mu.Unlock()
+	if !registered {
+		return nil
+	}
+	log.Printf("reject: %s (no run ID, this is run %s)", who, m.runID)
+	return status.Errorf(codes.Aborted, "no run ID given, the master is serving run %s", m.runID)
+}
+
+// checkRegisterRun is checkRun for Register, where a new slave has no run ID
+// yet.
+func (m *Master) checkRegisterRun(runID, who string) error {
+	if runID == "" || runID == m.runID {
+		return nil
+	}
+	log.Printf("reject: %s (run %s, this is run %s)", who, runID, m.runID)
+	return status.Errorf(codes.Aborted, "run %s is over, the master is serving run %s", runID, m.runID)
+}
+
+// isOtherRun reports whether the master told a slave that it belongs to
+// another run, which the slave has to exit for.
+func isOtherRun(err error) bool {
+	return status.Code(err) == codes.Aborted
+}
@@ -0,0 +1,85 @@
+package eupho
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// shardFiles returns the test files of the index-th of total shards. Every
+// shard computes the same partition from the same files, so that independent
+// jobs run each file exactly once.
+//
+// "hash" assigns a file by the hash of its path. "timing" balances the
+// recorded durations with the longest processing time first, counting files
+// without a timing as the average one.
+func shardFiles(files []string, index, total int, by string, t timings) ([]string, error) {
+	if total < 1 || index < 0 || index >= total {
+		return nil, fmt.Errorf("invalid shard %d of %d", index, total)
+	}
+
+	shard := []string{}
+	switch by {
+	case "hash", "":
+		for _, f := range files {
+			h := fnv.New32a()
+			h.Write([]byte(f))
+			if int(h.Sum32()%uint32(total)) == index {
+				shard = append(shard, f)
+			}
+		}
+	case "timing":
+		average, known := 0.0, 0
+		for _, f := range files {
+			if d, ok := t[f]; ok {
+				average += d
+				known++
+			}
+		}
+		if known > 0 {
+			average /= float64(known)
+		} else {
+			average = 1
+		}
+		duration := func(f string) float64 {
+			if d, ok := t[f]; ok {
+				return d
+			}
+			return average
+		}
+
+		sorted := make([]string, len(files))
+		copy(sorted, files)
+		sort.Slice(sorted, func(i, j int) bool {
+			di, dj := duration(sorted[i]), duration(sorted[j])
+			if di != dj {
+				return di > dj
+			}
+			return sorted[i] < sorted[j]
+		})
+
+		loads := make([]float64, total)
+		assigned := map[string]bool{}
+		for _, f := range sorted {
+			min := 0
+			for i := range loads {
+				if loads[i] < loads[min] {
+					min = i
+				}
+			}
+			loads[min] += duration(f)
+			if min == index {
+				assigned[f] = true
+			}
+		}
+		// keep the order in which the files were found
+		for _, f := range files {
+			if assigned[f] {
+				shard = append(shard, f)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown shard strategy: %s", by)
+	}
+	return shard, nil
+}
@@ -0,0 +1,44 @@
+package eupho
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestShardFiles(t *testing.T) {
+	files := []string{"t/01.t", "t/02.t", "t/03.t", "t/04.t", "t/05.t", "t/06.t"}
+
+	for _, by := range []string{"hash", "timing"} {
+		tm := timings{"t/01.t": 10, "t/02.t": 6, "t/03.t": 4, "t/04.t": 1}
+		all := []string{}
+		for i := 0; i < 3; i++ {
+			shard, err := shardFiles(files, i, 3, by, tm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			again, _ := shardFiles(files, i, 3, by, tm)
+			if !reflect.DeepEqual(shard, again) {
+				t.Errorf("%s: want the same shard every time\ngot %v and %v", by, shard, again)
+			}
+			all = append(all, shard...)
+		}
+		sort.Strings(all)
+		if !reflect.DeepEqual(all, files) {
+			t.Errorf("%s: want every file in exactly one shard\ngot %v", by, all)
+		}
+	}
+
+	// 10 + 1 | 6 + 4 | 5.25 + 5.25 (unknown files count as the average)
+	shard, _ := shardFiles(files, 0, 3, "timing", timings{"t/01.t": 10, "t/02.t": 6, "t/03.t": 4, "t/04.t": 1})
+	if !reflect.DeepEqual(shard, []string{"t/01.t", "t/04.t"}) {
+		t.Errorf("want [t/01.t t/04.t]\ngot %v", shard)
+	}
+
+	if _, err := shardFiles(files, 3, 3, "hash", nil); err == nil {
+		t.Error("want an error for an index out of range")
+	}
+	if _, err := shardFiles(files, 0, 3, "random", nil); err == nil {
+		t.Error("want an error for an unknown strategy")
+	}
+}
@@ -0,0 +1,30 @@
+package eupho
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifySignals calls f for every SIGINT or SIGTERM until stop is called.
+func notifySignals(f func(os.Signal)) (stop func()) {
+	sigCh := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for {
+			select {
+			case sig := <-sigCh:
+				f(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigCh)
+		close(done)
+	}
+}
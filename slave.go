@@ -1,21 +1,25 @@
 package eupho
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/Songmu/retry"
+	"github.com/golang/protobuf/ptypes"
 	"github.com/jessevdk/go-flags"
 	"github.com/mix3/eupho/test"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
 )
 
 type Slave struct {
@@ -26,56 +30,164 @@ type Slave struct {
 	chanSuites chan *test.Test
 	wgWorkers  *sync.WaitGroup
 
-	opts slaveOptions
-	args []string
+	opts SlaveConfig
 
-	submitted bool
+	submitted     bool
+	pluginNames   []string
+	execMap       map[string]string
+	tlsConfig     *tls.Config
+	token         string
+	runID         string
+	testFilesHash string
+	revision      string
+
+	// legacy is set for a master older than Register, which the slave only
+	// asks for test files and sends the results to.
+	legacy bool
+
+	mu      sync.Mutex
+	id      string
+	running map[string]bool
+	streams map[string]*resultStream
+	leases  map[string]int64 // lease ID of each running test file
+
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-type slaveOptions struct {
-	Addr       string        `             long:"addr"      default:"127.0.0.1:19300" description:"Listen addr"`
-	Jobs       int           `short:"j"    long:"jobs"                                description:"Run N test jobs in parallel"`
-	Exec       string        `             long:"exec"      default:"perl"            description:""`
-	Merge      bool          `             long:"merge"                               description:"Merge test scripts' STDERR with their STDOUT"`
-	PluginArgs []string      `short:"P"    long:"plugin"                              description:"plugins"`
-	Version    bool          `             long:"version"                             description:"Show version of eupho-slave"`
-	MaxDelay   time.Duration `             long:"max-delay" default:"3s"              description:"Max delay duration"`
-	MaxRetry   uint          `             long:"max-retry" default:"10"              description:"Max retry num"`
-	Quiet      bool          `short:"q"    long:"quiet"                               description:"quiet"`
+// SlaveConfig is the configuration of a slave. ParseArgs fills it from the
+// command line options.
+type SlaveConfig struct {
+	Addr          string        `             long:"addr"            default:"127.0.0.1:19300" description:"Listen addr"`
+	Jobs          int           `short:"j"    long:"jobs"                                      description:"Run N test jobs in parallel"`
+	Exec          string        `             long:"exec"            default:"perl"            description:"Interpreter of the .t test files, and of the others not in --exec-map"`
+	ExecMap       []string      `             long:"exec-map"                                  description:"Interpreter of the test files with an extension as .ext=interpreter, e.g. .py=python3. An empty interpreter runs them directly when executable or by their shebang line. Can be given multiple times"`
+	Merge         bool          `             long:"merge"                                     description:"Merge test scripts' STDERR with their STDOUT"`
+	PluginArgs    []string      `short:"P"    long:"plugin"                                    description:"plugins"`
+	Version       bool          `             long:"version"                                   description:"Show version of eupho-slave"`
+	MaxDelay      time.Duration `             long:"max-delay"       default:"3s"              description:"Max delay duration"`
+	MaxRetry      uint          `             long:"max-retry"       default:"10"              description:"Max retry num"`
+	Heartbeat     time.Duration `             long:"heartbeat"       default:"5s"              description:"Heartbeat interval"`
+	TestTimeout   time.Duration `             long:"test-timeout"                              description:"Kill a test script running longer than this duration"`
+	CaptureLimit  int           `             long:"capture-limit"   default:"65536"           description:"Bytes of STDOUT and STDERR of each test script to attach to the reports, 0 to disable"`
+	Quiet         bool          `short:"q"    long:"quiet"                                     description:"quiet"`
+	ShardIndex    int           `             long:"shard-index"                               description:"Run only the test files of this shard, counted from 0"`
+	ShardTotal    int           `             long:"shard-total"                               description:"Split the test files into this many shards"`
+	ShardBy       string        `             long:"shard-by"        default:"hash"            description:"How to split the test files: hash or timing"`
+	Timings       string        `             long:"timings"                                   description:"File of test durations used to balance the shards by timing"`
+	Ext           []string      `             long:"ext"             default:".t"              description:"Extension of the test files to find in directories. Can be given multiple times"`
+	Include       []string      `             long:"include"                                   description:"Only run the test files matching this glob. Can be given multiple times"`
+	Exclude       []string      `             long:"exclude"                                   description:"Skip the test files and directories matching this glob, like the lines of .euphoignore. Can be given multiple times"`
+	NoRecurse     bool          `             long:"no-recurse"                                description:"Do not look for test files in subdirectories"`
+	TLS           bool          `             long:"tls"                                       description:"Connect to the master over TLS, implied by the other --tls options"`
+	TLSCert       string        `             long:"tls-cert"                                  description:"Client certificate file to present to the master"`
+	TLSKey        string        `             long:"tls-key"                                   description:"Key file of --tls-cert"`
+	TLSCA         string        `             long:"tls-ca"                                    description:"Verify the master with the CAs in this file instead of the system roots"`
+	TLSServerName string        `             long:"tls-server-name"                           description:"Name to verify the certificate of the master with, the host of --addr by default"`
+	Token         string        `             long:"token"                                     description:"Shared secret to send to the master, EUPHO_TOKEN by default"`
+	TokenFile     string        `             long:"token-file"                                description:"Read --token from this file"`
+
+	// Args are the files, directories or globs to find the test files in.
+	Args []string
 }
 
 func NewSlave() *Slave {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Slave{
 		Plugins:    []Plugin{},
 		chanTests:  make(chan chan *test.Test),
 		chanSuites: make(chan *test.Test),
 		wgWorkers:  &sync.WaitGroup{},
+		running:    map[string]bool{},
+		streams:    map[string]*resultStream{},
+		leases:     map[string]int64{},
+		ctx:        ctx,
+		cancel:     cancel,
 	}
 }
 
-func (s *Slave) ParseArgs(args []string) {
-	var (
-		opts slaveOptions
-		err  error
-	)
+// DefaultSlaveConfig returns the configuration with the defaults of the
+// command line options.
+func DefaultSlaveConfig() SlaveConfig {
+	var c SlaveConfig
+	flags.NewParser(&c, flags.None).ParseArgs([]string{})
+	return c
+}
+
+// NewSlaveWithConfig returns a slave configured by c instead of ParseArgs.
+// Addr, Exec, Heartbeat and MaxRetry left zero take the defaults of
+// DefaultSlaveConfig.
+func NewSlaveWithConfig(c SlaveConfig) (*Slave, error) {
+	s := NewSlave()
+	if err := s.configure(c); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Slave) ParseArgs(args []string) error {
+	var opts SlaveConfig
 	parser := flags.NewParser(
 		&opts,
 		flags.HelpFlag|flags.PassDoubleDash,
 	)
-	s.args, err = parser.ParseArgs(args)
+	rest, err := parser.ParseArgs(args)
+	if err != nil {
+		return err
+	}
+	opts.Args = rest
+
+	return s.configure(opts)
+}
+
+func (s *Slave) configure(c SlaveConfig) error {
+	if c.Jobs < 1 {
+		c.Jobs = 1
+	}
+	def := DefaultSlaveConfig()
+	if c.Addr == "" {
+		c.Addr = def.Addr
+	}
+	if c.Exec == "" {
+		c.Exec = def.Exec
+	}
+	if err := defaultDuration("heartbeat", &c.Heartbeat, def.Heartbeat); err != nil {
+		return err
+	}
+	if c.MaxRetry == 0 {
+		c.MaxRetry = def.MaxRetry
+	}
+	if c.TestTimeout < 0 {
+		return &ConfigError{Option: "test-timeout", Err: fmt.Errorf("must not be negative: %s", c.TestTimeout)}
+	}
+	if c.CaptureLimit < 0 {
+		return &ConfigError{Option: "capture-limit", Err: fmt.Errorf("must not be negative: %d", c.CaptureLimit)}
+	}
+	execMap, err := parseExecMap(c.Exec, c.ExecMap)
 	if err != nil {
-		fmt.Println(err)
-		if e, ok := err.(*flags.Error); ok && e.Type == flags.ErrHelp {
-			os.Exit(0)
+		return &ConfigError{Option: "exec-map", Err: err}
+	}
+	if c.ShardTotal > 0 {
+		if _, err := shardFiles(nil, c.ShardIndex, c.ShardTotal, c.ShardBy, nil); err != nil {
+			return &ConfigError{Option: "shard-index", Err: err}
 		}
-		os.Exit(1)
 	}
 
-	s.opts = opts
-	if s.opts.Jobs < 1 {
-		s.opts.Jobs = 1
+	if c.TLS || c.TLSCert != "" || c.TLSKey != "" || c.TLSCA != "" || c.TLSServerName != "" {
+		s.tlsConfig, err = clientTLSConfig(c.TLSCert, c.TLSKey, c.TLSCA, c.TLSServerName)
+		if err != nil {
+			return &ConfigError{Option: "tls-cert", Err: err}
+		}
 	}
 
+	s.token, err = loadToken(c.Token, c.TokenFile)
+	if err != nil {
+		return &ConfigError{Option: "token-file", Err: err}
+	}
+
+	s.opts = c
+	s.execMap = execMap
+
 	for _, plugin := range s.opts.PluginArgs {
 		a := strings.SplitN(plugin, "=", 2)
 		name := a[0]
@@ -84,77 +196,201 @@ func (s *Slave) ParseArgs(args []string) {
 			pluginArgs = a[1]
 		}
 
-		loader, ok := pluginLoaders[name]
-		if !ok {
-			panic("plugin " + name + " not found")
+		p, err := loadPlugin(name, pluginArgs)
+		if err != nil {
+			s.closePlugins()
+			return &ConfigError{Option: "plugin", Err: err}
 		}
-		s.Plugins = append(s.Plugins, loader.Load(name, pluginArgs))
+		s.Plugins = append(s.Plugins, p)
+		s.pluginNames = append(s.pluginNames, name)
 	}
+	return nil
 }
 
-func (s *Slave) Run(args []string) {
+// Run runs the slave from the command line and returns the exit code.
+func (s *Slave) Run(args []string) int {
 	if args != nil {
-		s.ParseArgs(args)
+		if err := s.ParseArgs(args); err != nil {
+			return parseFailed(err)
+		}
 	}
 
 	if s.opts.Version {
 		fmt.Printf("eupho-slave %s, %s built for %s/%s\n", Version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
-		return
+		return 0
 	}
 
-	for i := 0; i < s.opts.Jobs; i++ {
-		w := NewWorker(s, i)
-		w.Start()
+	stopSignals := notifySignals(func(sig os.Signal) {
+		log.Printf("received %s, aborting", sig)
+		s.Abort()
+	})
+	defer stopSignals()
+
+	if err := s.RunContext(context.Background()); err != nil {
+		if err != ErrAborted {
+			log.Println(err)
+		}
+		return 1
 	}
+	return 0
+}
+
+// RunContext runs the test files given by the master until there are no
+// more, and closes the plugins. Canceling ctx aborts the run like Abort, and
+// ErrAborted is returned when the run was aborted.
+func (s *Slave) RunContext(ctx context.Context) error {
+	defer s.closePlugins()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Abort()
+		case <-done:
+		}
+	}()
 
-	testFiles := s.findTestFiles()
+	d := &discovery{
+		Exts:      s.opts.Ext,
+		Include:   s.opts.Include,
+		Exclude:   s.opts.Exclude,
+		NoRecurse: s.opts.NoRecurse,
+	}
+	testFiles, err := d.find(s.opts.Args)
+	if err != nil {
+		return err
+	}
+
+	s.testFilesHash = testFilesHash(testFiles)
+	s.revision = checkoutRevision()
+	if s.opts.ShardTotal > 0 {
+		testFiles, err = s.shard(testFiles)
+		if err != nil {
+			return err
+		}
+	}
+	mtimes := fileMtimes(testFiles)
 
-	conn, err := grpc.Dial(
-		s.opts.Addr,
-		grpc.WithInsecure(),
+	transport := grpc.WithInsecure()
+	if s.tlsConfig != nil {
+		transport = grpc.WithTransportCredentials(credentials.NewTLS(s.tlsConfig))
+	}
+	dialOpts := []grpc.DialOption{
+		transport,
 		grpc.WithBackoffMaxDelay(s.opts.MaxDelay),
-	)
+	}
+	if s.token != "" {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(tokenCredentials(s.token)))
+	}
+	conn, err := grpc.Dial(s.opts.Addr, dialOpts...)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer conn.Close()
 	client := NewEuphoClient(conn)
 
+	var rejected error
+	err = retry.Retry(s.opts.MaxRetry, s.opts.MaxDelay, func() error {
+		err := s.register(client)
+		switch status.Code(err) {
+		case codes.Unimplemented:
+			s.legacy = true
+			return nil
+		case codes.FailedPrecondition, codes.Unauthenticated:
+			// the master will not accept us however many times we try
+			rejected = err
+			return nil
+		}
+		return err
+	})
+	if err == nil {
+		err = rejected
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.legacy {
+		log.Println("the master does not support Register, running without heartbeats and result streams")
+	}
+
+	for i := 0; i < s.opts.Jobs; i++ {
+		w := NewWorker(s, i)
+		w.Start()
+	}
+
+	if !s.legacy {
+		go s.heartbeat(client, done)
+	}
+
+	var fetchErr, sendErr error
 	go func() {
 		var sendCh chan *test.Test
 		for {
 			sendCh = make(chan *test.Test)
 			s.chanTests <- sendCh
+			if s.ctx.Err() != nil {
+				break
+			}
 
 			var path string
+			var leaseID int64
+			var otherRun error
 			err := retry.Retry(s.opts.MaxRetry, s.opts.MaxDelay, func() error {
-				req := &GetTestRequest{Submitted: s.submitted}
+				req := &GetTestRequest{Submitted: s.submitted, SlaveId: s.slaveID(), RunId: s.currentRunID()}
 				if !s.submitted {
 					req.TestFiles = testFiles
+					req.TestFileMtimes = mtimes
+				}
+				res, err := client.GetTest(s.ctx, req)
+				if s.ctx.Err() != nil {
+					return nil // aborted, leave path empty
+				}
+				if isOtherRun(err) {
+					// retrying does not bring our run back
+					otherRun = err
+					return nil
 				}
-				res, err := client.GetTest(context.Background(), req)
 				if err != nil {
 					return err
 				}
 				s.submitted = true
-				path = res.Path
+				path, leaseID = res.Path, res.LeaseId
 				return nil
 			})
+			if err == nil {
+				err = otherRun
+			}
 			if err != nil {
-				log.Println(err)
+				fetchErr = err
 				break // ずっとエラるようだったら諦める
 			}
 			if path == "" {
 				break
 			}
 
-			sendCh <- &test.Test{
-				Path:  path,
-				Env:   []string{},
-				Exec:  s.opts.Exec,
-				Quiet: s.opts.Quiet,
-				Merge: s.opts.Merge,
+			t := &test.Test{
+				Path:         path,
+				Env:          []string{},
+				Exec:         s.opts.Exec,
+				ExecMap:      s.execMap,
+				Quiet:        s.opts.Quiet,
+				Merge:        s.opts.Merge,
+				Timeout:      s.opts.TestTimeout,
+				CaptureLimit: s.opts.CaptureLimit,
+			}
+			s.mu.Lock()
+			s.leases[path] = leaseID
+			s.mu.Unlock()
+			if !s.legacy {
+				if rs := s.openResultStream(client, t, leaseID); rs != nil {
+					s.mu.Lock()
+					s.streams[path] = rs
+					s.mu.Unlock()
+				}
 			}
+			sendCh <- t
 			close(sendCh)
 		}
 
@@ -165,21 +401,82 @@ func (s *Slave) Run(args []string) {
 	}()
 
 	for suite := range s.chanSuites {
-		err = retry.Retry(s.opts.MaxRetry, s.opts.MaxDelay, func() error {
+		s.mu.Lock()
+		rs := s.streams[suite.Path]
+		leaseID := s.leases[suite.Path]
+		delete(s.streams, suite.Path)
+		delete(s.leases, suite.Path)
+		s.mu.Unlock()
+
+		if sendErr != nil {
+			continue // gave up, wait for the workers to stop
+		}
+		if suite.Interrupted {
+			log.Printf("discard: %s (interrupted)", suite.Path)
+			if rs != nil {
+				rs.abandon()
+			}
+			continue
+		}
+		if rs != nil {
+			if err := rs.finish(suite); err == nil {
+				continue
+			}
+			log.Printf("failed to stream the result of %s, sending it again", suite.Path)
+		}
+		var otherRun error
+		err := retry.Retry(s.opts.MaxRetry, s.opts.MaxDelay, func() error {
 			_, err := client.Result(
 				context.Background(),
-				&ResultRequest{Path: suite.Path, Testsuite: suite.Suite},
+				&ResultRequest{
+					Path:       suite.Path,
+					Testsuite:  suite.Suite,
+					SlaveId:    s.slaveID(),
+					UserTime:   ptypes.DurationProto(suite.UserTime),
+					SystemTime: ptypes.DurationProto(suite.SystemTime),
+					Stdout:     suite.Stdout,
+					Stderr:     suite.Stderr,
+					RunId:      s.currentRunID(),
+					LeaseId:    leaseID,
+				},
 			)
 			if err != nil {
 				log.Println(err)
 			}
+			if isOtherRun(err) {
+				otherRun = err
+				return nil
+			}
 			return err
 		})
+		if err == nil {
+			err = otherRun
+		}
 		if err != nil {
-			break // ずっとエラるようだったら諦める
+			sendErr = err // ずっとエラるようだったら諦める
+			s.Abort()
 		}
 	}
 
+	if fetchErr != nil {
+		return fetchErr
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+	if s.ctx.Err() != nil {
+		return ErrAborted
+	}
+	return nil
+}
+
+// Abort stops requesting test files and kills the running test scripts.
+// RunContext returns after the plugins are closed.
+func (s *Slave) Abort() {
+	s.cancel()
+}
+
+func (s *Slave) closePlugins() {
 	for i := range s.Plugins {
 		if c, ok := s.Plugins[len(s.Plugins)-1-i].(io.Closer); ok {
 			c.Close()
@@ -187,39 +484,148 @@ func (s *Slave) Run(args []string) {
 	}
 }
 
-// Find Test Files
-func (s *Slave) findTestFiles() []string {
-	files := []string{}
-	if len(s.args) == 0 {
-		files = s.appendFindTestFiles(files, "t")
-	} else {
-		for _, parent := range s.args {
-			files = s.appendFindTestFiles(files, parent)
+func (s *Slave) register(client EuphoClient) error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	res, err := client.Register(context.Background(), &RegisterRequest{
+		Hostname:      hostname,
+		Jobs:          int32(s.opts.Jobs),
+		Plugins:       s.pluginNames,
+		Version:       Version,
+		TestFilesHash: s.testFilesHash,
+		Revision:      s.revision,
+		RunId:         s.currentRunID(),
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.id = res.SlaveId
+	s.runID = res.RunId
+	s.mu.Unlock()
+	log.Printf("registered as %s to run %s", res.SlaveId, res.RunId)
+
+	return nil
+}
+
+func (s *Slave) slaveID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
+
+// currentRunID returns the ID of the run the master gave at registration,
+// which is "" for a master older than run IDs.
+func (s *Slave) currentRunID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runID
+}
+
+// heartbeat reports the running test files to the master until done is closed.
+func (s *Slave) heartbeat(client EuphoClient, done <-chan struct{}) {
+	ticker := time.NewTicker(s.opts.Heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		res, err := client.Heartbeat(context.Background(), &HeartbeatRequest{
+			SlaveId: s.slaveID(),
+			Running: s.runningTests(),
+			RunId:   s.currentRunID(),
+		})
+		if err == nil && res.Abort {
+			log.Println("the master aborted the run")
+			s.Abort()
+			return
+		}
+		if status.Code(err) == codes.NotFound {
+			// the master does not know us any more, e.g. it was restarted
+			err = s.register(client)
+		}
+		if isOtherRun(err) {
+			log.Printf("the master is serving another run, exiting: %v", err)
+			s.Abort()
+			return
+		}
+		if err != nil {
+			log.Println(err)
 		}
 	}
-	return files
 }
 
-func (s *Slave) appendFindTestFiles(files []string, parent string) []string {
-	stat, err := os.Stat(parent)
-	if err != nil {
-		panic(err)
+func (s *Slave) setRunning(path string, running bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if running {
+		s.running[path] = true
+	} else {
+		delete(s.running, path)
 	}
-	if !stat.IsDir() {
-		return append(files, parent)
+}
+
+func (s *Slave) runningTests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	paths := make([]string, 0, len(s.running))
+	for path := range s.running {
+		paths = append(paths, path)
 	}
+	return paths
+}
 
-	filepath.Walk(parent, func(path string, info os.FileInfo, err error) error {
-		if info.IsDir() {
-			return nil
+// parseExecMap parses the --exec-map values. .t files are run with exec
+// unless they are mapped.
+func parseExecMap(exec string, args []string) (map[string]string, error) {
+	execMap := map[string]string{".t": exec}
+	for _, arg := range args {
+		a := strings.SplitN(arg, "=", 2)
+		if len(a) != 2 || a[0] == "" {
+			return nil, fmt.Errorf("invalid exec-map: %s (want .ext=interpreter)", arg)
 		}
-
-		if strings.HasSuffix(path, ".t") {
-			files = append(files, path)
+		ext := a[0]
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
 		}
+		execMap[ext] = a[1]
+	}
+	return execMap, nil
+}
 
-		return nil
-	})
+// shard picks the test files of the shard given by the options.
+func (s *Slave) shard(files []string) ([]string, error) {
+	var t timings
+	if s.opts.ShardBy == "timing" && s.opts.Timings != "" {
+		var err error
+		t, err = loadTimings(s.opts.Timings)
+		if err != nil {
+			log.Printf("failed to load timings: %v", err)
+		}
+	}
+	shard, err := shardFiles(files, s.opts.ShardIndex, s.opts.ShardTotal, s.opts.ShardBy, t)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("shard %d/%d: %d of %d test files", s.opts.ShardIndex, s.opts.ShardTotal, len(shard), len(files))
+	return shard, nil
+}
 
-	return files
+// fileMtimes returns the modification time of each file in Unix time, or 0
+// when it is unknown.
+func fileMtimes(files []string) []int64 {
+	mtimes := make([]int64, len(files))
+	for i, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			mtimes[i] = info.ModTime().Unix()
+		}
+	}
+	return mtimes
 }
@@ -9,6 +9,7 @@ import (
 	"sync"
 
 	"github.com/jessevdk/go-flags"
+	"golang.org/x/net/context"
 )
 
 type Solo struct {
@@ -17,20 +18,41 @@ type Solo struct {
 
 	wg sync.WaitGroup
 
-	opts soloOptions
+	opts SoloConfig
 }
 
-type soloOptions struct {
-	Jobs       string   `short:"j" long:"jobs"      default:"1"    description:"Run N test jobs in parallel"`
-	Exec       string   `          long:"exec"      default:"perl" description:""`
-	Merge      bool     `          long:"merge"                    description:"Merge test scripts' STDERR with their STDOUT"`
-	PluginArgs []string `short:"P" long:"plugin"                   description:"plugins"`
-	Version    bool     `          long:"version"                  description:"Show version of eupho-slave"`
-	MaxDelay   string   `          long:"max-delay" default:"3s"   description:"Max delay duration"`
-	MaxRetry   string   `          long:"max-retry" default:"10"   description:"Max retry num"`
-	Timeout    string   `          long:"timeout"   default:"10m"  description:"Timeout duration"`
-	Quiet      bool     `short:"q" long:"quiet"                    description:"quiet"`
-	Formatter  string   `          long:"formatter"                description:"Result formatter to use."`
+// SoloConfig is the configuration of a solo run. ParseArgs fills it from the
+// command line options. It is given to the master and the slave as their
+// command line options.
+type SoloConfig struct {
+	Jobs          string   `short:"j" long:"jobs"            default:"1"            description:"Run N test jobs in parallel"`
+	Exec          string   `          long:"exec"            default:"perl"         description:"Interpreter of the .t test files, and of the others not in --exec-map"`
+	ExecMap       []string `          long:"exec-map"                               description:"Interpreter of the test files with an extension as .ext=interpreter, e.g. .py=python3. An empty interpreter runs them directly when executable or by their shebang line. Can be given multiple times"`
+	Merge         bool     `          long:"merge"                                  description:"Merge test scripts' STDERR with their STDOUT"`
+	PluginArgs    []string `short:"P" long:"plugin"                                 description:"plugins"`
+	Version       bool     `          long:"version"                                description:"Show version of eupho-slave"`
+	MaxDelay      string   `          long:"max-delay"       default:"3s"           description:"Max delay duration"`
+	MaxRetry      string   `          long:"max-retry"       default:"10"           description:"Max retry num"`
+	Timeout       string   `          long:"timeout"         default:"10m"          description:"Timeout duration"`
+	TestTimeout   string   `          long:"test-timeout"    default:"0s"           description:"Kill a test script running longer than this duration"`
+	CaptureLimit  string   `          long:"capture-limit"   default:"65536"        description:"Bytes of STDOUT and STDERR of each test script to attach to the reports, 0 to disable"`
+	Quiet         bool     `short:"q" long:"quiet"                                  description:"quiet"`
+	Formatter     []string `          long:"formatter"                              description:"Result formatter to use as name[=args][:path], console by default. Can be given multiple times"`
+	Timings       string   `          long:"timings"                                description:"File to keep test durations in, used to run the slowest tests first"`
+	State         []string `          long:"state"                                  description:"Select test files by the previous runs and save the results: failed, passed, new, slow, fresh, save"`
+	StateFile     string   `          long:"state-file"      default:".eupho-state" description:"File to keep the state in"`
+	RetryFailed   string   `          long:"retry-failed"    default:"0"            description:"Re-run a failed test file up to N times"`
+	ShardIndex    string   `          long:"shard-index"     default:"0"            description:"Run only the test files of this shard, counted from 0"`
+	ShardTotal    string   `          long:"shard-total"     default:"0"            description:"Split the test files into this many shards, for independent CI jobs"`
+	ShardBy       string   `          long:"shard-by"        default:"hash"         description:"How to split the test files: hash or timing (needs --timings)"`
+	FlakyExitCode string   `          long:"flaky-exit-code" default:"0"            description:"Exit code when some test files passed only on retry"`
+	Ext           []string `          long:"ext"             default:".t"           description:"Extension of the test files to find in directories. Can be given multiple times"`
+	Include       []string `          long:"include"                                description:"Only run the test files matching this glob. Can be given multiple times"`
+	Exclude       []string `          long:"exclude"                                description:"Skip the test files and directories matching this glob, like the lines of .euphoignore. Can be given multiple times"`
+	NoRecurse     bool     `          long:"no-recurse"                             description:"Do not look for test files in subdirectories"`
+
+	// Args are the files, directories or globs to find the test files in.
+	Args []string
 }
 
 func NewSolo() *Solo {
@@ -40,60 +62,120 @@ func NewSolo() *Solo {
 	}
 }
 
-func (s *Solo) ParseArgs(args []string) {
-	var opts soloOptions
+// DefaultSoloConfig returns the configuration with the defaults of the
+// command line options.
+func DefaultSoloConfig() SoloConfig {
+	var c SoloConfig
+	flags.NewParser(&c, flags.None).ParseArgs([]string{})
+	return c
+}
+
+// NewSoloWithConfig returns a solo run configured by c instead of ParseArgs.
+// The options left empty take the defaults of the master and the slave.
+func NewSoloWithConfig(c SoloConfig) (*Solo, error) {
+	s := NewSolo()
+	if err := s.configure(c); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Solo) ParseArgs(args []string) error {
+	var opts SoloConfig
 	parser := flags.NewParser(
 		&opts,
 		flags.HelpFlag|flags.PassDoubleDash,
 	)
-	moreArgs, err := parser.ParseArgs(args)
+	describeFormatters(parser)
+	rest, err := parser.ParseArgs(args)
 	if err != nil {
-		fmt.Println(err)
-		if e, ok := err.(*flags.Error); ok && e.Type == flags.ErrHelp {
-			os.Exit(0)
-		}
-		os.Exit(1)
+		return err
 	}
-	s.opts = opts
+	opts.Args = rest
+
+	return s.configure(opts)
+}
+
+func (s *Solo) configure(c SoloConfig) error {
+	s.opts = c
 
 	l, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer l.Close()
 
-	masterArgs := []string{
-		"--timeout", s.opts.Timeout,
-		"--addr", l.Addr().String(),
-		"--quiet",
+	masterArgs := []string{"--addr", l.Addr().String(), "--quiet"}
+	masterArgs = appendOption(masterArgs, "--timeout", s.opts.Timeout)
+	masterArgs = appendOption(masterArgs, "--retry-failed", s.opts.RetryFailed)
+	masterArgs = appendOption(masterArgs, "--flaky-exit-code", s.opts.FlakyExitCode)
+	for _, f := range s.opts.Formatter {
+		masterArgs = append(masterArgs, "--formatter", f)
 	}
-	if s.opts.Formatter != "" {
-		masterArgs = append(masterArgs, "--formatter", s.opts.Formatter)
+	masterArgs = appendOption(masterArgs, "--timings", s.opts.Timings)
+	for _, st := range s.opts.State {
+		masterArgs = append(masterArgs, "--state", st)
 	}
-	s.Master.ParseArgs(masterArgs)
-
-	slaveArgs := []string{
-		"--addr", l.Addr().String(),
-		"--jobs", s.opts.Jobs,
-		"--exec", s.opts.Exec,
-		"--max-delay", s.opts.MaxDelay,
-		"--max-retry", s.opts.MaxRetry,
+	masterArgs = appendOption(masterArgs, "--state-file", s.opts.StateFile)
+	if err := s.Master.ParseArgs(masterArgs); err != nil {
+		return err
 	}
+
+	slaveArgs := []string{"--addr", l.Addr().String()}
+	slaveArgs = appendOption(slaveArgs, "--jobs", s.opts.Jobs)
+	slaveArgs = appendOption(slaveArgs, "--exec", s.opts.Exec)
+	slaveArgs = appendOption(slaveArgs, "--max-delay", s.opts.MaxDelay)
+	slaveArgs = appendOption(slaveArgs, "--max-retry", s.opts.MaxRetry)
+	slaveArgs = appendOption(slaveArgs, "--test-timeout", s.opts.TestTimeout)
+	slaveArgs = appendOption(slaveArgs, "--capture-limit", s.opts.CaptureLimit)
+	slaveArgs = appendOption(slaveArgs, "--shard-index", s.opts.ShardIndex)
+	slaveArgs = appendOption(slaveArgs, "--shard-total", s.opts.ShardTotal)
+	slaveArgs = appendOption(slaveArgs, "--shard-by", s.opts.ShardBy)
+	slaveArgs = appendOption(slaveArgs, "--timings", s.opts.Timings)
 	for _, p := range s.opts.PluginArgs {
 		slaveArgs = append(slaveArgs, "--plugin", p)
 	}
+	for _, m := range s.opts.ExecMap {
+		slaveArgs = append(slaveArgs, "--exec-map", m)
+	}
+	for _, ext := range s.opts.Ext {
+		slaveArgs = append(slaveArgs, "--ext", ext)
+	}
+	for _, pattern := range s.opts.Include {
+		slaveArgs = append(slaveArgs, "--include", pattern)
+	}
+	for _, pattern := range s.opts.Exclude {
+		slaveArgs = append(slaveArgs, "--exclude", pattern)
+	}
+	if s.opts.NoRecurse {
+		slaveArgs = append(slaveArgs, "--no-recurse")
+	}
 	if s.opts.Quiet {
 		slaveArgs = append(slaveArgs, "--quiet")
 	}
 	if s.opts.Merge {
 		slaveArgs = append(slaveArgs, "--merge")
 	}
-	s.Slave.ParseArgs(append(slaveArgs, moreArgs...))
+	return s.Slave.ParseArgs(append(append(slaveArgs, "--"), s.opts.Args...))
+}
+
+// appendOption appends an option with its value unless the value was left
+// empty in a SoloConfig built by hand, for the master or the slave to take
+// its default.
+func appendOption(args []string, name, value string) []string {
+	if value == "" {
+		return args
+	}
+	return append(args, name, value)
 }
 
+// Run runs the master and the slave from the command line and returns the
+// exit code.
 func (s *Solo) Run(args []string) int {
 	if args != nil {
-		s.ParseArgs(args)
+		if err := s.ParseArgs(args); err != nil {
+			return parseFailed(err)
+		}
 	}
 
 	if s.opts.Version {
@@ -101,17 +183,54 @@ func (s *Solo) Run(args []string) int {
 		return 0
 	}
 
-	code := 0
+	stopSignals := notifySignals(func(sig os.Signal) {
+		s.Master.abort(fmt.Sprintf("received %s", sig))
+		s.Slave.Abort()
+	})
+	defer stopSignals()
+
+	res, err := s.RunContext(context.Background())
+	if err != nil && err != ErrAborted {
+		log.Println(err)
+	}
+	if res == nil {
+		return 1
+	}
+	return res.ExitCode
+}
+
+// RunContext runs the master and the slave in this process. An error of the
+// slave, which aborts the master, is returned rather than ErrAborted, and an
+// error of the master rather than the abort of the slave it caused.
+func (s *Solo) RunContext(ctx context.Context) (*RunResult, error) {
+	var (
+		res       *RunResult
+		masterErr error
+		slaveErr  error
+	)
 	s.wg.Add(2)
 	go func() {
 		defer s.wg.Done()
-		code = s.Master.Run(nil)
+		res, masterErr = s.Master.RunContext(ctx)
+		if res == nil {
+			// the master failed to start
+			s.Slave.Abort()
+		}
 	}()
 	go func() {
 		defer s.wg.Done()
-		s.Slave.Run(nil)
+		slaveErr = s.Slave.RunContext(ctx)
+		// the master has finished unless the slave gave up, e.g. on a
+		// missing test file, so do not wait for the timeout
+		s.Master.abort("the slave stopped")
 	}()
 	s.wg.Wait()
 
-	return code
+	if slaveErr != nil && slaveErr != ErrAborted {
+		return res, slaveErr
+	}
+	if masterErr == nil {
+		masterErr = slaveErr
+	}
+	return res, masterErr
 }
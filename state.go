@@ -0,0 +1,140 @@
+package eupho
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/mix3/eupho/test"
+)
+
+// state is what --state remembers about each test file across runs, like
+// prove --state.
+type state struct {
+	Tests map[string]*testState `json:"tests"`
+}
+
+type testState struct {
+	// Result is "pass" or "fail".
+	Result string `json:"result"`
+
+	// Elapsed is the wall time of the last run in seconds.
+	Elapsed float64 `json:"elapsed"`
+
+	// Mtime is the modification time of the file on the slave at the last
+	// run, and LastRun when it ran, both in Unix time.
+	Mtime   int64 `json:"mtime,omitempty"`
+	LastRun int64 `json:"last_run"`
+}
+
+var stateSelectors = []string{"failed", "passed", "new", "slow", "fresh", "save"}
+
+// parseStateSelectors splits --state values like "failed,save".
+func parseStateSelectors(args []string) ([]string, error) {
+	selectors := []string{}
+	for _, arg := range args {
+		for _, sel := range strings.Split(arg, ",") {
+			if sel == "" {
+				continue
+			}
+			known := false
+			for _, s := range stateSelectors {
+				known = known || s == sel
+			}
+			if !known {
+				return nil, fmt.Errorf("unknown state: %s (available: %s)", sel, strings.Join(stateSelectors, ", "))
+			}
+			selectors = append(selectors, sel)
+		}
+	}
+	return selectors, nil
+}
+
+func loadState(file string) (*state, error) {
+	st := &state{Tests: map[string]*testState{}}
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, err
+	}
+	if st.Tests == nil {
+		st.Tests = map[string]*testState{}
+	}
+	return st, nil
+}
+
+func (st *state) save(file string) error {
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(file, b)
+}
+
+func (st *state) record(t *test.Test, mtime int64, now time.Time) {
+	ts := &testState{
+		Result:  "fail",
+		Mtime:   mtime,
+		LastRun: now.Unix(),
+	}
+	if t.Suite.Ok {
+		ts.Result = "pass"
+	}
+	if d, err := ptypes.Duration(t.Suite.Time); err == nil {
+		ts.Elapsed = d.Seconds()
+	}
+	st.Tests[t.Path] = ts
+}
+
+// selectFiles returns the paths chosen by the selectors. Files matching any
+// of failed, passed, new or fresh are selected, or every file when none of
+// them is given, and slow runs the slowest files first.
+func (st *state) selectFiles(paths []string, mtimes map[string]int64, selectors []string) []string {
+	filters := map[string]bool{}
+	slow := false
+	for _, sel := range selectors {
+		switch sel {
+		case "slow":
+			slow = true
+		case "failed", "passed", "new", "fresh":
+			filters[sel] = true
+		}
+	}
+
+	selected := []string{}
+	for _, path := range paths {
+		ts, known := st.Tests[path]
+		switch {
+		case len(filters) == 0,
+			filters["failed"] && known && ts.Result == "fail",
+			filters["passed"] && known && ts.Result == "pass",
+			filters["new"] && !known,
+			filters["fresh"] && (!known || mtimes[path] > ts.Mtime):
+			selected = append(selected, path)
+		}
+	}
+
+	if slow {
+		sort.SliceStable(selected, func(i, j int) bool {
+			return st.elapsed(selected[i]) > st.elapsed(selected[j])
+		})
+	}
+	return selected
+}
+
+func (st *state) elapsed(path string) float64 {
+	if ts, ok := st.Tests[path]; ok {
+		return ts.Elapsed
+	}
+	return 0
+}
@@ -0,0 +1,79 @@
+package eupho
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/mix3/eupho/test"
+	pet "gopkg.in/mix3/pet.v3"
+)
+
+func TestState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, ".eupho-state")
+
+	st, err := loadState(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	st.record(&test.Test{Path: "t/pass.t", Suite: &pet.Testsuite{Ok: true, Time: ptypes.DurationProto(1 * time.Second)}}, 100, now)
+	st.record(&test.Test{Path: "t/fail.t", Suite: &pet.Testsuite{Ok: false, Time: ptypes.DurationProto(2 * time.Second)}}, 100, now)
+	st.record(&test.Test{Path: "t/slow.t", Suite: &pet.Testsuite{Ok: true, Time: ptypes.DurationProto(9 * time.Second)}}, 100, now)
+	if err := st.save(file); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err = loadState(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{"t/fail.t", "t/new.t", "t/pass.t", "t/slow.t"}
+	mtimes := map[string]int64{"t/fail.t": 100, "t/new.t": 100, "t/pass.t": 200, "t/slow.t": 100}
+	for _, c := range []struct {
+		selectors []string
+		want      []string
+	}{
+		{[]string{"failed"}, []string{"t/fail.t"}},
+		{[]string{"passed"}, []string{"t/pass.t", "t/slow.t"}},
+		{[]string{"new"}, []string{"t/new.t"}},
+		{[]string{"fresh"}, []string{"t/new.t", "t/pass.t"}},
+		{[]string{"failed", "new"}, []string{"t/fail.t", "t/new.t"}},
+		{[]string{"slow", "save"}, []string{"t/slow.t", "t/fail.t", "t/pass.t", "t/new.t"}},
+	} {
+		got := st.selectFiles(paths, mtimes, c.selectors)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%v: want %v\ngot %v", c.selectors, c.want, got)
+		}
+	}
+
+	if _, err := parseStateSelectors([]string{"failed,sav"}); err == nil {
+		t.Error("want an error for an unknown state")
+	}
+}
+
+func TestState_initTestFiles(t *testing.T) {
+	m := NewMaster()
+	m.selectors = []string{"failed"}
+	m.state = &state{Tests: map[string]*testState{
+		"t/01.t": {Result: "pass"},
+		"t/02.t": {Result: "fail"},
+	}}
+	m.initTestFiles(false, []string{"t/01.t", "t/02.t"}, []int64{1, 2})
+
+	if !reflect.DeepEqual(m.pending, []string{"t/02.t"}) {
+		t.Errorf("want only the failed file to be dispatched\ngot %v", m.pending)
+	}
+	if m.mtimes["t/01.t"] != 1 {
+		t.Errorf("want the mtime to be kept\ngot %d", m.mtimes["t/01.t"])
+	}
+}
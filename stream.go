@@ -0,0 +1,183 @@
+package eupho
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/mix3/eupho/test"
+	pet "gopkg.in/mix3/pet.v3"
+)
+
+// ResultStream receives the test lines and the output of a test file while it
+// runs, followed by its testsuite once it finished.
+func (m *Master) ResultStream(stream Eupho_ResultStreamServer) error {
+	ctx := stream.Context()
+
+	var path, holder string
+	var leaseID int64
+	for {
+		ev, err := stream.Recv()
+		if err == io.EOF {
+			// the slave gave up the test file, keep what arrived so far
+			return stream.SendAndClose(&ResultResponse{})
+		}
+		if err != nil {
+			return err
+		}
+
+		if path == "" {
+			if err := m.checkRun(ev.RunId, ev.SlaveId, fmt.Sprintf("result of %s from %s", ev.Path, peerAddr(ctx))); err != nil {
+				return err
+			}
+			if err := m.checkRegistered(ev.SlaveId); err != nil {
+				return err
+			}
+			path, leaseID = ev.Path, ev.LeaseId
+			holder = m.holder(ctx, ev.SlaveId)
+			m.startPartial(path)
+		}
+		if m.isAborted() {
+			log.Printf("ignore: %s (run aborted)", path)
+			return stream.SendAndClose(&ResultResponse{})
+		}
+
+		if ev.Testline != nil {
+			m.progress(path, ev.Testline)
+		}
+		if len(ev.Output) > 0 && m.opts.Verbose {
+			os.Stderr.Write(ev.Output)
+		}
+		if ev.Testsuite != nil {
+			if m.resultReceived(leaseID) {
+				log.Printf("ignore: %s (result of lease %d already received)", path, leaseID)
+				return stream.SendAndClose(&ResultResponse{})
+			}
+			m.mu.Lock()
+			log.Printf("receive: %s <- %s", path, m.describe(holder))
+			m.mu.Unlock()
+			m.endCheck(holder, leaseID, &test.Test{
+				Path:       path,
+				Suite:      ev.Testsuite,
+				UserTime:   durationOf(ev.UserTime),
+				SystemTime: durationOf(ev.SystemTime),
+				Stdout:     ev.Stdout,
+				Stderr:     ev.Stderr,
+			})
+			return stream.SendAndClose(&ResultResponse{})
+		}
+	}
+}
+
+// startPartial forgets the test lines of a previous attempt of path.
+func (m *Master) startPartial(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.partial[path] = &pet.Testsuite{Ok: true, Plan: -1}
+}
+
+// progress records a test line of a running test file and shows the first
+// failure of the file immediately.
+func (m *Master) progress(path string, line *pet.Testline) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	suite, ok := m.partial[path]
+	if !ok {
+		return
+	}
+	suite.Tests = append(suite.Tests, line)
+
+	if line.Ok || line.Directive == pet.Testline_TODO || !suite.Ok {
+		return
+	}
+	suite.Ok = false
+	log.Printf("fail: %s: %s", path, line.ResultString())
+	if !m.opts.Quiet && line.Diagnostic != "" {
+		fmt.Fprintln(os.Stderr, line.Diagnostic)
+	}
+}
+
+// partialSuite returns the test lines received for a test file whose result
+// never arrived.
+func (m *Master) partialSuite(path string) *pet.Testsuite {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	suite, ok := m.partial[path]
+	if !ok {
+		return nil
+	}
+	suite.Ok = false
+	suite.Plan = int32(len(suite.Tests))
+	return suite
+}
+
+// resultStream sends the progress of a running test file to the master.
+type resultStream struct {
+	mu     sync.Mutex
+	stream Eupho_ResultStreamClient
+	broken bool
+}
+
+func (s *Slave) openResultStream(client EuphoClient, t *test.Test, leaseID int64) *resultStream {
+	stream, err := client.ResultStream(s.ctx)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	rs := &resultStream{stream: stream}
+	rs.send(&ResultEvent{Path: t.Path, SlaveId: s.slaveID(), RunId: s.currentRunID(), LeaseId: leaseID})
+	t.OnTestline = func(line *pet.Testline) {
+		rs.send(&ResultEvent{Testline: line})
+	}
+	t.OnOutput = func(b []byte) {
+		rs.send(&ResultEvent{Output: b})
+	}
+	return rs
+}
+
+func (rs *resultStream) send(ev *ResultEvent) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.broken {
+		return
+	}
+	if err := rs.stream.Send(ev); err != nil {
+		log.Println(err)
+		rs.broken = true
+	}
+}
+
+// finish sends the testsuite and closes the stream. An error means that the
+// result has to be sent again in another way.
+func (rs *resultStream) finish(t *test.Test) error {
+	rs.send(&ResultEvent{
+		Testsuite:  t.Suite,
+		UserTime:   ptypes.DurationProto(t.UserTime),
+		SystemTime: ptypes.DurationProto(t.SystemTime),
+		Stdout:     t.Stdout,
+		Stderr:     t.Stderr,
+	})
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.broken {
+		return fmt.Errorf("result stream is broken")
+	}
+	_, err := rs.stream.CloseAndRecv()
+	return err
+}
+
+// abandon closes the stream without a testsuite.
+func (rs *resultStream) abandon() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if !rs.broken {
+		rs.stream.CloseSend()
+	}
+}
@@ -1,13 +1,20 @@
 package test
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"regexp"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/mattn/go-shellwords"
+	"golang.org/x/net/context"
 	pet "gopkg.in/mix3/pet.v3"
 )
 
@@ -16,33 +23,135 @@ type Test struct {
 	Env  []string
 	Exec string
 
+	// ExecMap maps extensions of test files, like ".py", to the interpreter
+	// to run them with. Those mapped to "" are run directly when they are
+	// executable, with the interpreter of their shebang line, or with Exec.
+	// Other test files are run with Exec.
+	ExecMap map[string]string
+
 	// Merge test scripts' STDERR with their STDOUT.
 	Merge bool
 
+	// Timeout kills the test script with all of its children when it does
+	// not finish in time. Zero means no timeout.
+	Timeout time.Duration
+
+	// CaptureLimit is the number of bytes of the STDOUT and the STDERR of
+	// the test script to keep in Stdout and Stderr. Zero disables capturing.
+	CaptureLimit int
+
 	Suite *pet.Testsuite
 	Quiet bool
+
+	Stdout []byte
+	Stderr []byte
+
+	// Interrupted reports that the test script was killed because the
+	// context given to RunContext was canceled.
+	Interrupted bool
+
+	// OnTestline and OnOutput are called while the test script runs, with
+	// each parsed test line and each chunk of its standard output.
+	OnTestline func(line *pet.Testline)
+	OnOutput   func(b []byte)
+
+	// Attempts is the number of times the test was dispatched, and Flaky
+	// reports that it passed only after a failed attempt.
+	Attempts int
+	Flaky    bool
+
+	// Slave is the slave which ran the test, and Hostname the host it runs
+	// on.
+	Slave    string
+	Hostname string
+
+	// RunID is the ID of the run the result belongs to.
+	RunID string
+
+	// StartTime and EndTime are when the master dispatched the test and
+	// received its result.
+	StartTime time.Time
+	EndTime   time.Time
+
+	// UserTime and SystemTime are the CPU times consumed by the test script
+	// and its children.
+	UserTime   time.Duration
+	SystemTime time.Duration
 }
 
 func (t *Test) Run() *pet.Testsuite {
-	execParam, _ := shellwords.Parse(t.Exec)
-	execParam = append(execParam, t.Path)
+	return t.RunContext(context.Background())
+}
+
+// RunContext runs the test script and kills it with all of its children when
+// ctx is canceled or the timeout expires.
+func (t *Test) RunContext(ctx context.Context) *pet.Testsuite {
+	execParam := t.command()
 	cmd := exec.Command(execParam[0], execParam[1:]...)
 	cmd.Env = t.Env
 
 	r, w := io.Pipe()
-	cmd.Stdout = w
+	var stdout io.Writer = w
+
+	lr, lw := io.Pipe()
+	if t.OnTestline != nil {
+		stdout = io.MultiWriter(stdout, lw)
+	}
+	if t.OnOutput != nil {
+		stdout = io.MultiWriter(stdout, outputFunc(t.OnOutput))
+	}
+	var stdoutCapture, stderrCapture *capture
+	if t.CaptureLimit > 0 {
+		stdoutCapture = &capture{limit: t.CaptureLimit}
+		stdout = io.MultiWriter(stdout, stdoutCapture)
+	}
+	cmd.Stdout = stdout
 
 	if t.Merge {
-		cmd.Stderr = w
+		cmd.Stderr = stdout
+	} else if t.CaptureLimit > 0 {
+		stderrCapture = &capture{limit: t.CaptureLimit}
+		cmd.Stderr = io.MultiWriter(os.Stderr, stderrCapture)
 	} else {
 		cmd.Stderr = os.Stderr
 	}
 
+	parent := ctx
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+	if ctx.Done() != nil {
+		setProcessGroup(cmd)
+	}
+
 	if err := cmd.Start(); err != nil {
 		t.Suite = errorTestsuite(err)
 		return t.Suite
 	}
 
+	exited := make(chan struct{})
+	killed := make(chan error, 1)
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		select {
+		case <-ctx.Done():
+			killProcessGroup(cmd)
+			killed <- ctx.Err()
+		case <-exited:
+		}
+	}()
+
+	lined := make(chan struct{})
+	go func() {
+		defer close(lined)
+		if t.OnTestline != nil {
+			t.parseTestlines(lr)
+		}
+	}()
+
 	ch := make(chan *pet.Testsuite)
 	go func() {
 		parser, err := pet.NewParser(r)
@@ -59,11 +168,40 @@ func (t *Test) Run() *pet.Testsuite {
 	}()
 
 	err := cmd.Wait()
+	close(exited)
+	if cmd.ProcessState != nil {
+		t.UserTime = cmd.ProcessState.UserTime()
+		t.SystemTime = cmd.ProcessState.SystemTime()
+	}
+	<-watched
 	w.Close()
+	lw.Close()
+	<-lined
 	r.Close()
+	lr.Close()
 
 	suite := <-ch
 	t.Suite = suite
+	t.Stdout = stdoutCapture.Bytes()
+	t.Stderr = stderrCapture.Bytes()
+
+	select {
+	case <-killed:
+		description := fmt.Sprintf("Test timed out after %s", t.Timeout)
+		if parent.Err() != nil {
+			t.Interrupted = true
+			description = "Test was interrupted"
+		}
+		suite.Ok = false
+		suite.Plan++
+		suite.Tests = append(suite.Tests, &pet.Testline{
+			Ok:          false,
+			Num:         suite.Plan,
+			Description: description,
+		})
+		return suite
+	default:
+	}
 
 	if err == nil {
 		return suite
@@ -102,6 +240,130 @@ func (t *Test) Run() *pet.Testsuite {
 	return suite
 }
 
+func (t *Test) parseTestlines(r io.Reader) {
+	// keep reading until the end, so that the test script is never blocked
+	defer io.Copy(ioutil.Discard, r)
+
+	parser, err := pet.NewParser(r)
+	if err != nil {
+		return
+	}
+	for {
+		line, err := parser.Next()
+		if err != nil {
+			return
+		}
+		t.OnTestline(line)
+	}
+}
+
+// harnessResult matches the descriptions of the test lines which Run adds
+// for a test script which timed out, was interrupted or died.
+var harnessResult = regexp.MustCompile(`^(Test timed out after .+|Test was interrupted|Test died with return code -?\d+|unexpected error)$`)
+
+// HarnessResult returns the test line which Run added to suite for a test
+// script which did not end well, or nil when every test line was printed by
+// the script.
+func HarnessResult(suite *pet.Testsuite) *pet.Testline {
+	if len(suite.Tests) == 0 {
+		return nil
+	}
+	line := suite.Tests[len(suite.Tests)-1]
+	if line.Ok || line.Num != suite.Plan || !harnessResult.MatchString(line.Description) {
+		return nil
+	}
+	return line
+}
+
+// truncated ends the output captured beyond the CaptureLimit.
+var truncated = regexp.MustCompile(`\n\[truncated at \d+ bytes\]\n$`)
+
+// IsTruncated reports whether the captured output b lost its end to the
+// CaptureLimit.
+func IsTruncated(b []byte) bool {
+	return truncated.Match(b)
+}
+
+// capture keeps the first bytes written to it up to limit.
+type capture struct {
+	limit     int
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (c *capture) Write(b []byte) (int, error) {
+	if n := c.limit - c.buf.Len(); n < len(b) {
+		c.buf.Write(b[:n])
+		c.truncated = true
+	} else {
+		c.buf.Write(b)
+	}
+	return len(b), nil
+}
+
+// Bytes returns the captured output, noting if some of it was dropped.
+func (c *capture) Bytes() []byte {
+	if c == nil || c.buf.Len() == 0 {
+		return nil
+	}
+	if c.truncated {
+		return append(c.buf.Bytes(), fmt.Sprintf("\n[truncated at %d bytes]\n", c.limit)...)
+	}
+	return c.buf.Bytes()
+}
+
+type outputFunc func(b []byte)
+
+func (f outputFunc) Write(b []byte) (int, error) {
+	f(append([]byte(nil), b...))
+	return len(b), nil
+}
+
+// command returns the command line running the test script.
+func (t *Test) command() []string {
+	interpreter, ext, mapped := t.Exec, "", false
+	for e, i := range t.ExecMap {
+		// the longest extension wins, e.g. ".test.js" over ".js"
+		if strings.HasSuffix(t.Path, e) && len(e) > len(ext) {
+			interpreter, ext, mapped = i, e, true
+		}
+	}
+	// only an empty interpreter in the map asks for the detection, other
+	// test files are run with Exec
+	if mapped && interpreter == "" {
+		if info, err := os.Stat(t.Path); err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0 {
+			return []string{t.Path}
+		}
+		if shebang := readShebang(t.Path); shebang != nil {
+			return append(shebang, t.Path)
+		}
+		interpreter = t.Exec
+	}
+
+	execParam, _ := shellwords.Parse(interpreter)
+	return append(execParam, t.Path)
+}
+
+// readShebang returns the interpreter and its arguments on the "#!" line of
+// file, or nil when there is none.
+func readShebang(file string) []string {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	line, _ := bufio.NewReader(io.LimitReader(f, 256)).ReadString('\n')
+	if !strings.HasPrefix(line, "#!") {
+		return nil
+	}
+	fields := strings.Fields(line[2:])
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
 func errorTestsuite(err error) *pet.Testsuite {
 	return &pet.Testsuite{
 		Ok: false,
@@ -3,7 +3,13 @@ package test
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	pet "gopkg.in/mix3/pet.v3"
 )
 
 func TestRun_success(t *testing.T) {
@@ -156,4 +162,195 @@ func TestRun_exitNonZero(t *testing.T) {
 	if suite.Tests[1].Ok {
 		t.Error("want fail\ngot success")
 	}
+	if HarnessResult(suite) != suite.Tests[1] {
+		t.Errorf("want the harness result %v\ngot %v", suite.Tests[1], HarnessResult(suite))
+	}
+}
+
+func TestRun_timeout(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`$| = 1; print "1..2\nok 1\n"; system("sleep 10"); print "ok 2\n";`)
+
+	test := &Test{
+		Path:    f.Name(),
+		Env:     os.Environ(),
+		Exec:    "perl",
+		Timeout: 500 * time.Millisecond,
+	}
+
+	start := time.Now()
+	suite := test.Run()
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("want the test to be killed after the timeout\ngot %s", d)
+	}
+
+	if suite.Ok {
+		t.Error("want fail\ngot success")
+	}
+	if len(suite.Tests) != 2 {
+		t.Fatalf("want 2\ngot %d", len(suite.Tests))
+	}
+	if !suite.Tests[0].Ok {
+		t.Error("want success\ngot fail")
+	}
+	if want := "Test timed out after 500ms"; suite.Tests[1].Description != want {
+		t.Errorf("want %q\ngot %q", want, suite.Tests[1].Description)
+	}
+	if HarnessResult(suite) != suite.Tests[1] {
+		t.Errorf("want the harness result %v\ngot %v", suite.Tests[1], HarnessResult(suite))
+	}
+}
+
+func TestRunContext_cancel(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`$| = 1; print "1..2\nok 1\n"; system("sleep 10"); print "ok 2\n";`)
+
+	test := &Test{
+		Path: f.Name(),
+		Env:  os.Environ(),
+		Exec: "perl",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(500*time.Millisecond, cancel)
+
+	start := time.Now()
+	suite := test.RunContext(ctx)
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("want the test to be killed on cancel\ngot %s", d)
+	}
+
+	if !test.Interrupted {
+		t.Error("want the test to be interrupted")
+	}
+	if suite.Ok {
+		t.Error("want fail\ngot success")
+	}
+	if want := "Test was interrupted"; suite.Tests[len(suite.Tests)-1].Description != want {
+		t.Errorf("want %q\ngot %q", want, suite.Tests[len(suite.Tests)-1].Description)
+	}
+}
+
+func TestRun_callbacks(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`print "1..2\nok 1\nnot ok 2\n";`)
+
+	lines := []string{}
+	output := ""
+	test := &Test{
+		Path: f.Name(),
+		Env:  os.Environ(),
+		Exec: "perl",
+		OnTestline: func(line *pet.Testline) {
+			lines = append(lines, line.ResultString())
+		},
+		OnOutput: func(b []byte) {
+			output += string(b)
+		},
+	}
+	test.Run()
+
+	if len(lines) != 2 || lines[0] != "ok 1" || lines[1] != "not ok 2" {
+		t.Errorf("want [ok 1 not ok 2]\ngot %v", lines)
+	}
+	if output != "1..2\nok 1\nnot ok 2\n" {
+		t.Errorf("want the whole output\ngot %q", output)
+	}
+}
+
+func TestRun_capture(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`print "1..1\nok 1\n"; print STDERR "warning\n" x 10;`)
+
+	test := &Test{
+		Path:         f.Name(),
+		Env:          os.Environ(),
+		Exec:         "perl",
+		CaptureLimit: 16,
+	}
+
+	test.Run()
+	if string(test.Stdout) != "1..1\nok 1\n" {
+		t.Errorf("want %q\ngot %q", "1..1\nok 1\n", test.Stdout)
+	}
+	want := "warning\nwarning\n\n[truncated at 16 bytes]\n"
+	if string(test.Stderr) != want {
+		t.Errorf("want %q\ngot %q", want, test.Stderr)
+	}
+	if IsTruncated(test.Stdout) || !IsTruncated(test.Stderr) {
+		t.Errorf("want only STDERR to be truncated\ngot %v, %v", IsTruncated(test.Stdout), IsTruncated(test.Stderr))
+	}
+	if HarnessResult(test.Suite) != nil {
+		t.Errorf("want no harness result\ngot %v", HarnessResult(test.Suite))
+	}
+}
+
+func TestRun_execMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := []struct {
+		name    string
+		content string
+		mode    os.FileMode
+	}{
+		{"mapped.sh", "echo 1..1; echo ok 1\n", 0644},
+		{"shebang.test", "#!/bin/sh\necho 1..1; echo ok 1\n", 0644},
+		{"executable.run", "#!/bin/sh\necho 1..1; echo ok 1\n", 0755},
+		{"fallback.pl", `print "1..1\nok 1\n";`, 0644},
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if err := ioutil.WriteFile(path, []byte(f.content), f.mode); err != nil {
+			t.Fatal(err)
+		}
+
+		test := &Test{
+			Path:    path,
+			Env:     os.Environ(),
+			Exec:    "perl",
+			ExecMap: map[string]string{".sh": "sh", ".test": "", ".run": ""},
+		}
+		suite := test.Run()
+		if !suite.Ok || len(suite.Tests) != 1 {
+			t.Errorf("%s: want success\ngot %v", f.name, suite)
+		}
+	}
+
+	test := &Test{
+		Path:    "t/app.test.js",
+		Exec:    "perl",
+		ExecMap: map[string]string{".js": "node", ".test.js": "node --test-reporter=tap"},
+	}
+	if cmd := test.command(); strings.Join(cmd, " ") != "node --test-reporter=tap t/app.test.js" {
+		t.Errorf("want the longest extension to win\ngot %v", cmd)
+	}
+
+	// without an empty interpreter in the map, executable and shebang test
+	// files are still run with Exec
+	path := filepath.Join(dir, "executable.t")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\necho 1..1; echo ok 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, execMap := range []map[string]string{nil, {".sh": "sh"}} {
+		test := &Test{Path: path, Exec: "perl", ExecMap: execMap}
+		if cmd := test.command(); strings.Join(cmd, " ") != "perl "+path {
+			t.Errorf("ExecMap %v: want Exec\ngot %v", execMap, cmd)
+		}
+	}
 }
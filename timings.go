@@ -0,0 +1,77 @@
+package eupho
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/golang/protobuf/ptypes"
+	pet "gopkg.in/mix3/pet.v3"
+)
+
+// timings holds the wall time in seconds of each test file measured by the
+// previous runs.
+type timings map[string]float64
+
+func loadTimings(file string) (timings, error) {
+	t := timings{}
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t timings) save(file string) error {
+	b, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(file, b)
+}
+
+// writeFileAtomic replaces file with b, so that a run killed while saving
+// does not leave a broken file behind.
+func writeFileAtomic(file string, b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".eupho-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+func (t timings) record(path string, suite *pet.Testsuite) {
+	if suite == nil || suite.Time == nil {
+		return
+	}
+	d, err := ptypes.Duration(suite.Time)
+	if err != nil {
+		return
+	}
+	t[path] = d.Seconds()
+}
+
+// sort orders paths so that the slowest test files come first (longest
+// processing time first). Unknown paths keep their order after known ones.
+func (t timings) sort(paths []string) {
+	sort.SliceStable(paths, func(i, j int) bool {
+		return t[paths[i]] > t[paths[j]]
+	})
+}
@@ -0,0 +1,43 @@
+package eupho
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	pet "gopkg.in/mix3/pet.v3"
+)
+
+func TestTimings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "timings.json")
+
+	tm, err := loadTimings(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm.record("t/fast.t", &pet.Testsuite{Time: ptypes.DurationProto(1 * time.Second)})
+	tm.record("t/slow.t", &pet.Testsuite{Time: ptypes.DurationProto(9 * time.Second)})
+	if err := tm.save(file); err != nil {
+		t.Fatal(err)
+	}
+
+	tm, err = loadTimings(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{"t/fast.t", "t/new1.t", "t/slow.t", "t/new2.t"}
+	tm.sort(paths)
+	want := []string{"t/slow.t", "t/fast.t", "t/new1.t", "t/new2.t"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("want %v\ngot %v", want, paths)
+	}
+}
@@ -0,0 +1,67 @@
+package eupho
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// serverTLSConfig returns the TLS configuration of the master. Slaves must
+// present a certificate signed by ca when it is given.
+func serverTLSConfig(cert, key, ca string) (*tls.Config, error) {
+	if cert == "" || key == "" {
+		return nil, fmt.Errorf("both of a certificate and a key are needed")
+	}
+	pair, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{pair}}
+	if ca != "" {
+		pool, err := loadCertPool(ca)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// clientTLSConfig returns the TLS configuration of a slave. The master is
+// verified with ca, or the system roots when it is not given, and cert is
+// presented to a master verifying the slaves.
+func clientTLSConfig(cert, key, ca, serverName string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: serverName}
+	if cert != "" || key != "" {
+		if cert == "" || key == "" {
+			return nil, fmt.Errorf("both of a certificate and a key are needed")
+		}
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+	if ca != "" {
+		pool, err := loadCertPool(ca)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificates in %s", file)
+	}
+	return pool, nil
+}
@@ -0,0 +1,147 @@
+package eupho
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// writeCert writes a certificate signed by parent, or a self-signed CA when
+// parent is nil, to name.pem and name-key.pem in dir.
+func writeCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	ioutil.WriteFile(filepath.Join(dir, name+"-key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return cert, key
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eupho")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca, caKey := writeCert(t, dir, "ca", nil, nil)
+	writeCert(t, dir, "master", ca, caKey)
+	writeCert(t, dir, "slave", ca, caKey)
+	ioutil.WriteFile(filepath.Join(dir, "01.t"), []byte(`print "1..1\nok 1\n";`), 0644)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	mc := DefaultMasterConfig()
+	mc.Addr = addr
+	mc.Quiet = true
+	mc.Formatter = []string{"json:" + filepath.Join(dir, "report.json")}
+	mc.TLSCert = filepath.Join(dir, "master.pem")
+	mc.TLSKey = filepath.Join(dir, "master-key.pem")
+	mc.TLSCA = filepath.Join(dir, "ca.pem")
+	m, err := NewMasterWithConfig(mc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a slave without a client certificate is refused
+	sc := DefaultSlaveConfig()
+	sc.Addr = addr
+	sc.Quiet = true
+	sc.MaxRetry = 2
+	sc.MaxDelay = 100 * time.Millisecond
+	sc.TLSCA = filepath.Join(dir, "ca.pem")
+	sc.Args = []string{dir}
+	anonymous, err := NewSlaveWithConfig(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sc.TLSCert = filepath.Join(dir, "slave.pem")
+	sc.TLSKey = filepath.Join(dir, "slave-key.pem")
+	s, err := NewSlaveWithConfig(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type outcome struct {
+		res *RunResult
+		err error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		res, err := m.RunContext(context.Background())
+		done <- outcome{res, err}
+	}()
+
+	if err := anonymous.RunContext(context.Background()); err == nil {
+		t.Error("want an error for a slave without a client certificate")
+	}
+	if err := s.RunContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	o := <-done
+	if o.err != nil {
+		t.Fatal(o.err)
+	}
+	if o.res.Files != 1 || !o.res.Ok() {
+		t.Errorf("want 1 passed test file\ngot %+v", o.res)
+	}
+}
+
+func TestTLSConfig_errors(t *testing.T) {
+	c := DefaultMasterConfig()
+	c.TLSCA = "ca.pem"
+	if _, err := NewMasterWithConfig(c); err == nil {
+		t.Error("want an error for --tls-ca without --tls-cert")
+	}
+
+	sc := DefaultSlaveConfig()
+	sc.TLSCert = "slave.pem"
+	if _, err := NewSlaveWithConfig(sc); err == nil {
+		t.Error("want an error for --tls-cert without --tls-key")
+	}
+}
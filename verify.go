@@ -0,0 +1,104 @@
+package eupho
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// checkout is what --verify compares between the master and the slaves.
+type checkout struct {
+	TestFilesHash string
+	Revision      string
+
+	// source tells where the expectation came from, for the errors
+	source string
+}
+
+// testFilesHash identifies a list of test files regardless of its order.
+func testFilesHash(files []string) string {
+	sorted := make([]string, len(files))
+	copy(sorted, files)
+	sort.Strings(sorted)
+
+	h := sha1.New()
+	for _, f := range sorted {
+		io.WriteString(h, filepath.ToSlash(f)+"\n")
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// checkoutRevision returns the git commit checked out in the working
+// directory, or "" when it is not a git repository.
+func checkoutRevision() string {
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// verifySlave checks that a registering slave found the same test files in
+// the same checkout as the master, or as the first slave when the master does
+// not discover the test files itself. m.mu must be held.
+func (m *Master) verifySlave(req *RegisterRequest, who string) error {
+	if !m.opts.Verify {
+		return nil
+	}
+	if m.expected == nil {
+		m.expected = &checkout{
+			TestFilesHash: req.TestFilesHash,
+			Revision:      req.Revision,
+			source:        "the first slave " + who,
+		}
+		return nil
+	}
+
+	if req.TestFilesHash != m.expected.TestFilesHash {
+		return status.Errorf(
+			codes.FailedPrecondition,
+			"rejected %s: its test files differ from %s (hash %s, want %s)",
+			who, m.expected.source, shortHash(req.TestFilesHash), shortHash(m.expected.TestFilesHash),
+		)
+	}
+	if req.Revision != m.expected.Revision {
+		return status.Errorf(
+			codes.FailedPrecondition,
+			"rejected %s: its checkout is at revision %s, but %s is at %s",
+			who, shortHash(req.Revision), m.expected.source, shortHash(m.expected.Revision),
+		)
+	}
+	return nil
+}
+
+// checkRegistered rejects the RPCs of slaves that were not verified by
+// Register when --verify is given.
+func (m *Master) checkRegistered(slaveID string) error {
+	if !m.opts.Verify {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.slaves[slaveID]; !ok {
+		return status.Errorf(codes.PermissionDenied, "unverified slave %q: --verify needs slaves to register", slaveID)
+	}
+	return nil
+}
+
+func shortHash(h string) string {
+	if h == "" {
+		return "unknown"
+	}
+	if len(h) > 12 {
+		return h[:12]
+	}
+	return h
+}
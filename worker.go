@@ -15,6 +15,9 @@ type Worker struct {
 
 func NewWorker(slave *Slave, id int) *Worker {
 	env := append(os.Environ(), fmt.Sprintf("GO_PROVE_WORKER_ID=%d", id))
+	if runID := slave.currentRunID(); runID != "" {
+		env = append(env, "EUPHO_RUN_ID="+runID)
+	}
 	return &Worker{
 		Env:   env,
 		slave: slave,
@@ -35,7 +38,9 @@ func (w *Worker) run() {
 			}
 			test.Env = w.Env
 			log.Printf("start %s", test.Path)
-			test.Run()
+			w.slave.setRunning(test.Path, true)
+			test.RunContext(w.slave.ctx)
+			w.slave.setRunning(test.Path, false)
 			w.slave.chanSuites <- test
 			log.Printf("finish %s", test.Path)
 		}